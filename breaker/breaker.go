@@ -0,0 +1,184 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen 熔断器处于打开状态，请求被拒绝
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// Closed 正常放行请求，统计失败
+	Closed State = iota
+	// Open 拒绝请求，冷却时间结束后转为HalfOpen
+	Open
+	// HalfOpen 放行一个探测请求，成功则关闭，失败则重新打开
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Config 熔断器配置
+type Config struct {
+	// Failures 连续失败次数达到此值时打开，0表示不按连续失败判断
+	Failures int
+	// ErrorRate 统计窗口内错误率（百分比）达到此值时打开，0表示不按错误率判断
+	ErrorRate int
+	// MinRequests 统计窗口内请求数达到此值时才按错误率判断
+	MinRequests int
+	// Window 错误率的统计窗口
+	Window time.Duration
+	// Cooldown 打开后转为HalfOpen前的冷却时间
+	Cooldown time.Duration
+}
+
+// Enabled 至少配置了一种打开条件
+func (c *Config) Enabled() bool {
+	return c.Failures > 0 || c.ErrorRate > 0
+}
+
+// Breaker 熔断器，并发安全
+type Breaker struct {
+	conf Config
+
+	mu    sync.Mutex
+	state State
+	// consecutive 连续失败次数
+	consecutive int
+	// windowStart total failed 当前统计窗口的开始时间、请求数与失败数
+	windowStart time.Time
+	total       int
+	failed      int
+	// openedAt 最近一次打开的时间
+	openedAt time.Time
+	// probing HalfOpen状态下已放行探测请求
+	probing bool
+}
+
+func New(conf Config) *Breaker {
+	return &Breaker{conf: conf, windowStart: time.Now()}
+}
+
+// State 返回当前状态，冷却结束的Open状态视为HalfOpen
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshLocked(time.Now())
+	return b.state
+}
+
+// Ready 判断当前是否可以放行请求，不改变状态，用于负载均衡前过滤实例
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshLocked(time.Now())
+	return b.state == Closed || (b.state == HalfOpen && !b.probing)
+}
+
+// Allow 请求前调用，返回false时请求应被拒绝
+// HalfOpen状态下只放行一个探测请求，放行的请求须通过Record或Release结束
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshLocked(time.Now())
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Record 记录请求结果
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.refreshLocked(now)
+
+	switch b.state {
+	case HalfOpen:
+		if !b.probing {
+			return
+		}
+		b.probing = false
+		if success {
+			b.resetLocked(now, Closed)
+		} else {
+			b.resetLocked(now, Open)
+		}
+		return
+	case Open:
+		// 打开前放行的请求，结果不再统计
+		return
+	}
+
+	b.total++
+	if success {
+		b.consecutive = 0
+		return
+	}
+	b.consecutive++
+	b.failed++
+
+	if b.conf.Failures > 0 && b.consecutive >= b.conf.Failures {
+		b.resetLocked(now, Open)
+		return
+	}
+	if b.conf.ErrorRate > 0 && b.total >= b.conf.MinRequests && b.failed*100 >= b.conf.ErrorRate*b.total {
+		b.resetLocked(now, Open)
+	}
+}
+
+// Release 放行的请求未产生可统计的结果（如调用方取消）时调用
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *Breaker) refreshLocked(now time.Time) {
+	if b.state == Open && now.Sub(b.openedAt) >= b.conf.Cooldown {
+		b.state = HalfOpen
+		b.probing = false
+	}
+	if b.state == Closed && b.conf.Window > 0 && now.Sub(b.windowStart) >= b.conf.Window {
+		b.windowStart = now
+		b.total = 0
+		b.failed = 0
+	}
+}
+
+func (b *Breaker) resetLocked(now time.Time, state State) {
+	b.state = state
+	b.consecutive = 0
+	b.total = 0
+	b.failed = 0
+	b.windowStart = now
+	if state == Open {
+		b.openedAt = now
+	}
+}
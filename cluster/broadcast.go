@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// BroadcastCluster 广播调用所有实例，任意一个失败则返回错误，适用于通知所有提供者更新缓存等操作
+type BroadcastCluster struct {
+}
+
+func init() {
+	RegisterCluster(constants.BroadcastCluster, &BroadcastCluster{})
+}
+
+func (b *BroadcastCluster) Invoke(ctx context.Context, inv Invocation) (interface{}, error) {
+	ids := inv.Instances()
+	if len(ids) == 0 {
+		return nil, merr.ErrNoInstance
+	}
+
+	results := make([]forkResult, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			res, err := inv.Invoke(ctx, id)
+			results[i] = forkResult{res: res, err: err}
+		}(i, id)
+	}
+	wg.Wait()
+
+	var res interface{}
+	var lastErr error
+	for i, r := range results {
+		if r.err != nil {
+			logger.Error("broadcast rpc call %s to %s error: %s", inv.ServiceMethod(), ids[i], r.err)
+			lastErr = r.err
+			continue
+		}
+		res = r.res
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return res, nil
+}
@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"context"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/loadbalance"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// FailbackCluster 失败自动恢复，调用失败时返回零值，将失败请求加入RetryQueue在后台定时重试，适用于消息通知等操作
+type FailbackCluster struct {
+}
+
+func init() {
+	RegisterCluster(constants.FailbackCluster, &FailbackCluster{})
+}
+
+func (f *FailbackCluster) Invoke(ctx context.Context, inv Invocation) (interface{}, error) {
+	lbInv := &loadbalance.Invocation{}
+	id, err := inv.Select(lbInv)
+	if err == nil {
+		var res interface{}
+		res, err = inv.Invoke(ctx, id)
+		if err == nil {
+			return res, nil
+		}
+		lbInv.Exclude(id)
+	}
+
+	if err != nil && !inv.Retryable(err) {
+		logger.Error("failback ignore error of rpc call %s: %s", inv.ServiceMethod(), err)
+		return nil, nil
+	}
+
+	// 调用方返回后失败请求由队列在后台重试，队列已满时丢弃
+	if q := inv.RetryQueue(); q == nil || !q.Add(ctx, inv, lbInv) {
+		logger.Error("failback rpc call %s error: %s, retry queue is full, drop it", inv.ServiceMethod(), err)
+		return nil, nil
+	}
+	logger.Error("failback rpc call %s error: %s, will retry in background", inv.ServiceMethod(), err)
+	return nil, nil
+}
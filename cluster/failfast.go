@@ -0,0 +1,26 @@
+package cluster
+
+import (
+	"context"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+// FailfastCluster 快速失败，只调用一次，失败立即返回错误，适用于非幂等操作
+type FailfastCluster struct {
+}
+
+func init() {
+	RegisterCluster(constants.FailfastCluster, &FailfastCluster{})
+}
+
+func (f *FailfastCluster) Invoke(ctx context.Context, inv Invocation) (interface{}, error) {
+	id, err := inv.Select(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv.Invoke(ctx, id)
+}
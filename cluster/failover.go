@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/loadbalance"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// FailoverCluster 失败自动切换，调用失败或超时时重试其他实例
+type FailoverCluster struct {
+}
+
+func init() {
+	RegisterCluster(constants.FailoverCluster, &FailoverCluster{})
+}
+
+func (f *FailoverCluster) Invoke(ctx context.Context, inv Invocation) (interface{}, error) {
+	// 记录本次调用中失败的实例，重试时选择其他实例
+	lbInv := &loadbalance.Invocation{}
+	var lastErr error
+	for i := 0; i <= inv.Retries(); i++ {
+		if i > 0 {
+			logger.Warn("rpc call %s failed: %s, retry %d", inv.ServiceMethod(), lastErr, i)
+			if !wait(ctx, inv.Backoff(i)) {
+				break
+			}
+		}
+
+		id, err := inv.Select(lbInv)
+		if err != nil {
+			// 重试时没有可选的实例（如均已失败被排除、熔断器打开），返回之前调用的错误
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
+		res, err := inv.Invoke(ctx, id)
+		if err == nil {
+			return res, nil
+		}
+		lastErr = err
+		lbInv.Exclude(id)
+
+		if ctx.Err() != nil || !inv.Retryable(err) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+// wait 等待退避时间，ctx取消时返回false
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
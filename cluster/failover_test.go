@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/loadbalance"
+)
+
+var (
+	errRemote    = errors.New("remote error")
+	errTimeout   = errors.New("timeout")
+	errBreaker   = errors.New("breaker is open")
+	errNoService = errors.New("no instance found")
+)
+
+// fakeInvocation 按顺序返回预设结果的调用
+type fakeInvocation struct {
+	retries int
+	// selects 第i次选择实例返回的错误，为nil或超出长度时选择第一个未被排除的实例
+	selects []error
+	// results 实例ID->调用返回的错误
+	results map[string]error
+	ids     []string
+	// calls 调用过的实例
+	calls    []string
+	selected int
+}
+
+func (f *fakeInvocation) ServiceMethod() string { return "hello.Hello" }
+
+func (f *fakeInvocation) Retries() int { return f.retries }
+
+func (f *fakeInvocation) Backoff(retry int) time.Duration { return 0 }
+
+func (f *fakeInvocation) Retryable(err error) bool { return err != errRemote }
+
+func (f *fakeInvocation) Forks() int { return 1 }
+
+func (f *fakeInvocation) Select(lbInv *loadbalance.Invocation) (string, error) {
+	i := f.selected
+	f.selected++
+	if i < len(f.selects) && f.selects[i] != nil {
+		return "", f.selects[i]
+	}
+	for _, id := range f.ids {
+		if _, ok := lbInv.Excluded[id]; !ok {
+			return id, nil
+		}
+	}
+	return "", errNoService
+}
+
+func (f *fakeInvocation) Instances() []string { return f.ids }
+
+func (f *fakeInvocation) Invoke(ctx context.Context, id string) (interface{}, error) {
+	f.calls = append(f.calls, id)
+	if err := f.results[id]; err != nil {
+		return nil, err
+	}
+	res := id
+	return &res, nil
+}
+
+func (f *fakeInvocation) RetryQueue() *RetryQueue { return nil }
+
+func TestFailoverCluster_Invoke(t *testing.T) {
+	tests := []struct {
+		name      string
+		inv       *fakeInvocation
+		want      string
+		wantErr   error
+		wantCalls []string
+	}{
+		{
+			name:      "success",
+			inv:       &fakeInvocation{retries: 2, ids: []string{"a", "b"}},
+			want:      "a",
+			wantCalls: []string{"a"},
+		},
+		{
+			name:      "retry other instance",
+			inv:       &fakeInvocation{retries: 2, ids: []string{"a", "b"}, results: map[string]error{"a": errTimeout}},
+			want:      "b",
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "retries exhausted",
+			inv:       &fakeInvocation{retries: 1, ids: []string{"a", "b", "c"}, results: map[string]error{"a": errTimeout, "b": errTimeout}},
+			wantErr:   errTimeout,
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "not retryable",
+			inv:       &fakeInvocation{retries: 2, ids: []string{"a", "b"}, results: map[string]error{"a": errRemote}},
+			wantErr:   errRemote,
+			wantCalls: []string{"a"},
+		},
+		{
+			name:    "select error on first attempt",
+			inv:     &fakeInvocation{retries: 2, ids: []string{"a"}, selects: []error{errBreaker}},
+			wantErr: errBreaker,
+		},
+		{
+			name:      "no instance left on retry returns call error",
+			inv:       &fakeInvocation{retries: 2, ids: []string{"a"}, results: map[string]error{"a": errTimeout}},
+			wantErr:   errTimeout,
+			wantCalls: []string{"a"},
+		},
+		{
+			name:      "breaker open on retry returns call error",
+			inv:       &fakeInvocation{retries: 2, ids: []string{"a", "b"}, selects: []error{nil, errBreaker}, results: map[string]error{"a": errTimeout}},
+			wantErr:   errTimeout,
+			wantCalls: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := (&FailoverCluster{}).Invoke(context.Background(), tt.inv)
+			if err != tt.wantErr {
+				t.Fatalf("Invoke() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && *res.(*string) != tt.want {
+				t.Errorf("Invoke() = %v, want %v", *res.(*string), tt.want)
+			}
+			if !reflect.DeepEqual(tt.inv.calls, tt.wantCalls) {
+				t.Errorf("Invoke() calls = %v, want %v", tt.inv.calls, tt.wantCalls)
+			}
+		})
+	}
+}
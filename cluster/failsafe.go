@@ -0,0 +1,32 @@
+package cluster
+
+import (
+	"context"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// FailsafeCluster 失败安全，出现错误时记录日志并忽略，返回零值
+type FailsafeCluster struct {
+}
+
+func init() {
+	RegisterCluster(constants.FailsafeCluster, &FailsafeCluster{})
+}
+
+func (f *FailsafeCluster) Invoke(ctx context.Context, inv Invocation) (interface{}, error) {
+	id, err := inv.Select(nil)
+	if err == nil {
+		var res interface{}
+		res, err = inv.Invoke(ctx, id)
+		if err == nil {
+			return res, nil
+		}
+	}
+
+	logger.Error("failsafe ignore error of rpc call %s: %s", inv.ServiceMethod(), err)
+	return nil, nil
+}
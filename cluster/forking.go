@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"context"
+	"math/rand"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	merr "github.com/ForeverSRC/morax/error"
+)
+
+// ForkingCluster 并行调用多个实例，只要一个成功即返回，适用于实时性要求较高的读操作
+type ForkingCluster struct {
+}
+
+func init() {
+	RegisterCluster(constants.ForkingCluster, &ForkingCluster{})
+}
+
+type forkResult struct {
+	res interface{}
+	err error
+}
+
+func (f *ForkingCluster) Invoke(ctx context.Context, inv Invocation) (interface{}, error) {
+	ids := inv.Instances()
+	if len(ids) == 0 {
+		return nil, merr.ErrNoInstance
+	}
+
+	forks := inv.Forks()
+	if forks <= 0 || forks > len(ids) {
+		forks = len(ids)
+	}
+	rand.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+
+	// 首个成功的调用返回后，取消其余调用
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resCh := make(chan forkResult, forks)
+	for _, id := range ids[:forks] {
+		go func(id string) {
+			res, err := inv.Invoke(ctx, id)
+			resCh <- forkResult{res: res, err: err}
+		}(id)
+	}
+
+	var lastErr error
+	for i := 0; i < forks; i++ {
+		r := <-resCh
+		if r.err == nil {
+			return r.res, nil
+		}
+		lastErr = r.err
+	}
+
+	return nil, lastErr
+}
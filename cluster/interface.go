@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/loadbalance"
+)
+
+// Invocation 一次消费方法调用
+type Invocation interface {
+	// ServiceMethod 调用的服务方法，格式为provider.method
+	ServiceMethod() string
+	// Retries 重试次数
+	Retries() int
+	// Backoff 第retry次重试前的等待时间
+	Backoff(retry int) time.Duration
+	// Retryable 判断错误是否可以重试
+	Retryable(err error) bool
+	// Forks forking模式下并行调用的实例数
+	Forks() int
+	// Select 通过负载均衡选择一个实例，lbInv中排除的实例不参与选择
+	Select(lbInv *loadbalance.Invocation) (string, error)
+	// Instances 当前所有可用实例的ID
+	Instances() []string
+	// Invoke 对指定实例进行一次调用，返回指向结果的指针
+	Invoke(ctx context.Context, id string) (interface{}, error)
+	// RetryQueue failback模式下失败请求的重试队列
+	RetryQueue() *RetryQueue
+}
+
+// Cluster 集群容错策略
+// 调用成功但无结果（如failsafe、failback吞掉错误）时返回nil，由调用方返回零值
+type Cluster interface {
+	Invoke(ctx context.Context, inv Invocation) (interface{}, error)
+}
@@ -0,0 +1,27 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+)
+
+type Clusters struct {
+	allCluster map[string]Cluster
+}
+
+var clusters = Clusters{
+	allCluster: make(map[string]Cluster),
+}
+
+func RegisterCluster(clusterType string, c Cluster) {
+	clusters.allCluster[clusterType] = c
+}
+
+func DoInvoke(ctx context.Context, cType string, inv Invocation) (interface{}, error) {
+	c, ok := clusters.allCluster[cType]
+	if !ok {
+		return nil, fmt.Errorf("un found cluster type:%s", cType)
+	}
+
+	return c.Invoke(ctx, inv)
+}
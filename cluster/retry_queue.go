@@ -0,0 +1,190 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/loadbalance"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// RetryQueue failback模式下的失败请求队列，容量有限，由后台goroutine定时重试
+// 重试使用的context保留调用方context中的值（如元数据），在队列的生命周期结束时取消，不受调用方返回的影响
+type RetryQueue struct {
+	ctx  context.Context
+	size int
+
+	mu      sync.Mutex // protects pending, closed
+	pending []*failedRequest
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// failedRequest 等待重试的失败请求
+type failedRequest struct {
+	ctx   context.Context
+	inv   Invocation
+	lbInv *loadbalance.Invocation
+	// retried 已重试次数，retries 最大重试次数
+	retried int
+	retries int
+	next    time.Time
+}
+
+// NewRetryQueue 创建失败请求队列并启动后台重试，ctx为重试的生命周期，size为队列容量
+func NewRetryQueue(ctx context.Context, size int) *RetryQueue {
+	if size <= 0 {
+		size = constants.DefaultFailbackQueueSize
+	}
+	q := &RetryQueue{
+		ctx:  ctx,
+		size: size,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Add 加入失败请求，队列已满或已关闭时丢弃并返回false
+func (q *RetryQueue) Add(ctx context.Context, inv Invocation, lbInv *loadbalance.Invocation) bool {
+	retries := inv.Retries()
+	if retries <= 0 {
+		retries = constants.DefaultFailbackRetries
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || len(q.pending) >= q.size {
+		return false
+	}
+	q.pending = append(q.pending, &failedRequest{
+		ctx:     &detachedContext{Context: q.ctx, values: ctx},
+		inv:     inv,
+		lbInv:   lbInv,
+		retries: retries,
+		next:    time.Now().Add(constants.FailbackRetryInterval),
+	})
+	return true
+}
+
+// Len 等待重试的请求数
+func (q *RetryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Drain 停止定时重试，对队列中剩余的请求立即重试一次，仍失败的请求记录日志后丢弃
+func (q *RetryQueue) Drain() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	<-q.done
+
+	q.mu.Lock()
+	reqs := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	wg := new(sync.WaitGroup)
+	for _, r := range reqs {
+		wg.Add(1)
+		go func(r *failedRequest) {
+			defer wg.Done()
+			if !q.retry(r) {
+				logger.Error("failback drop rpc call %s on shutdown", r.inv.ServiceMethod())
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// run 定时检查队列，请求在失败后约FailbackRetryInterval时重试
+func (q *RetryQueue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(constants.FailbackRetryInterval / 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			q.retryDue()
+		}
+	}
+}
+
+// retryDue 并发重试到期的请求，失败且未达到重试次数的请求重新加入队列
+func (q *RetryQueue) retryDue() {
+	now := time.Now()
+	q.mu.Lock()
+	var due []*failedRequest
+	rest := q.pending[:0]
+	for _, r := range q.pending {
+		if r.next.After(now) {
+			rest = append(rest, r)
+		} else {
+			due = append(due, r)
+		}
+	}
+	q.pending = rest
+	q.mu.Unlock()
+
+	wg := new(sync.WaitGroup)
+	for _, r := range due {
+		wg.Add(1)
+		go func(r *failedRequest) {
+			defer wg.Done()
+			if q.retry(r) || r.retried >= r.retries {
+				return
+			}
+			r.next = time.Now().Add(constants.FailbackRetryInterval)
+			q.mu.Lock()
+			q.pending = append(q.pending, r)
+			q.mu.Unlock()
+		}(r)
+	}
+	wg.Wait()
+}
+
+// retry 重试一次，成功或错误不可重试时返回true
+func (q *RetryQueue) retry(r *failedRequest) bool {
+	r.retried++
+	inv := r.inv
+	id, err := inv.Select(r.lbInv)
+	if err == nil {
+		if _, err = inv.Invoke(r.ctx, id); err == nil {
+			logger.Info("failback rpc call %s success after %d retries", inv.ServiceMethod(), r.retried)
+			return true
+		}
+		r.lbInv.Exclude(id)
+	}
+
+	logger.Error("failback rpc call %s retry %d error: %s", inv.ServiceMethod(), r.retried, err)
+	return !inv.Retryable(err)
+}
+
+// detachedContext 取消与deadline来自Context，值来自values
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c *detachedContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+import (
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+// Codec 编解码器
+// 在流式协议中，每条消息依次编码消息头与消息体；在帧协议中，只用于编码消息体
+type Codec interface {
+	// Name 编解码器名称，用于链接协商与注册中心元数据
+	Name() string
+	// ID 编解码器编号，用于帧协议的帧头
+	ID() uint8
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder v为nil时丢弃下一个值
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// RequestHeader 请求头，其后为请求参数
+type RequestHeader struct {
+	ServiceMethod string
+	Seq           uint64
+	// Timeout 调用方剩余的时间预算，单位毫秒
+	Timeout int64
+	// Meta 请求元数据
+	Meta metadata.MD
+}
+
+// ResponseHeader 响应头，其后为返回值，出错时返回值为空结构体
+type ResponseHeader struct {
+	ServiceMethod string
+	Seq           uint64
+	// Error 错误信息，为空时调用成功
+	Error string
+	// Status 提供者返回的结构化错误
+	Status *merr.Error
+	// Meta 响应元数据
+	Meta metadata.MD
+}
+
+var (
+	codecs   = make(map[string]Codec)
+	codecIds = make(map[uint8]Codec)
+)
+
+func RegisterCodec(c Codec) {
+	codecs[c.Name()] = c
+	codecIds[c.ID()] = c
+}
+
+func GetCodec(name string) (Codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("un found codec type:%s", name)
+	}
+	return c, nil
+}
+
+// Marshal 使用编解码器将v编码为字节，用于帧协议的消息体
+func Marshal(c Codec, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func Unmarshal(c Codec, b []byte, v interface{}) error {
+	return c.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func GetCodecByID(id uint8) (Codec, error) {
+	c, ok := codecIds[id]
+	if !ok {
+		return nil, fmt.Errorf("un found codec id:%d", id)
+	}
+	return c, nil
+}
+
+// Names 返回支持的编解码器名称
+func Names() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
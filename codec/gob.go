@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+type GobCodec struct {
+}
+
+func init() {
+	RegisterCodec(&GobCodec{})
+}
+
+func (g *GobCodec) Name() string {
+	return constants.GobCodec
+}
+
+func (g *GobCodec) ID() uint8 {
+	return constants.GobCodecId
+}
+
+func (g *GobCodec) NewEncoder(w io.Writer) Encoder {
+	return gob.NewEncoder(w)
+}
+
+func (g *GobCodec) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
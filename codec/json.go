@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+// JsonCodec 流式协议中json使用与net/rpc/jsonrpc兼容的编解码器，此处只用于帧协议的消息体
+type JsonCodec struct {
+}
+
+func init() {
+	RegisterCodec(&JsonCodec{})
+}
+
+func (j *JsonCodec) Name() string {
+	return constants.JsonCodec
+}
+
+func (j *JsonCodec) ID() uint8 {
+	return constants.JsonCodecId
+}
+
+func (j *JsonCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (j *JsonCodec) NewDecoder(r io.Reader) Decoder {
+	return &jsonDecoder{dec: json.NewDecoder(r)}
+}
+
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+func (d *jsonDecoder) Decode(v interface{}) error {
+	if v == nil {
+		var discard json.RawMessage
+		return d.dec.Decode(&discard)
+	}
+	return d.dec.Decode(v)
+}
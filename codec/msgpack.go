@@ -0,0 +1,52 @@
+package codec
+
+import (
+	"io"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackCodec 使用结构体的json标签作为字段名，与json编解码器共用请求与返回值结构体
+type MsgpackCodec struct {
+}
+
+func init() {
+	RegisterCodec(&MsgpackCodec{})
+}
+
+func (m *MsgpackCodec) Name() string {
+	return constants.MsgpackCodec
+}
+
+func (m *MsgpackCodec) ID() uint8 {
+	return constants.MsgpackCodecId
+}
+
+func (m *MsgpackCodec) NewEncoder(w io.Writer) Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc
+}
+
+func (m *MsgpackCodec) NewDecoder(r io.Reader) Decoder {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return &msgpackDecoder{dec: dec}
+}
+
+type msgpackDecoder struct {
+	dec *msgpack.Decoder
+}
+
+func (d *msgpackDecoder) Decode(v interface{}) error {
+	if v == nil {
+		return d.dec.Skip()
+	}
+	return d.dec.Decode(v)
+}
@@ -0,0 +1,114 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxProtoMessageSize 单个值的最大长度，避免错误的长度前缀导致分配过多内存
+const maxProtoMessageSize = 64 << 20
+
+// ProtobufCodec 请求参数与返回值需实现proto.Message，每个值以varint长度前缀分隔
+// 消息头按codec/morax.proto中定义的格式编码，便于其它语言实现
+type ProtobufCodec struct {
+}
+
+func init() {
+	RegisterCodec(&ProtobufCodec{})
+}
+
+func (p *ProtobufCodec) Name() string {
+	return constants.ProtobufCodec
+}
+
+func (p *ProtobufCodec) ID() uint8 {
+	return constants.ProtobufCodecId
+}
+
+func (p *ProtobufCodec) NewEncoder(w io.Writer) Encoder {
+	return &protoEncoder{w: w}
+}
+
+func (p *ProtobufCodec) NewDecoder(r io.Reader) Decoder {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &protoDecoder{r: br}
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+type protoEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (e *protoEncoder) Encode(v interface{}) error {
+	var b []byte
+	switch m := v.(type) {
+	case *RequestHeader:
+		b = m.appendProto(nil)
+	case *ResponseHeader:
+		b = m.appendProto(nil)
+	case proto.Message:
+		var err error
+		if b, err = proto.Marshal(m); err != nil {
+			return err
+		}
+	case struct{}:
+		// 出错时的响应体
+	default:
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+
+	e.buf = protowire.AppendVarint(e.buf[:0], uint64(len(b)))
+	e.buf = append(e.buf, b...)
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+type protoDecoder struct {
+	r byteReader
+}
+
+func (d *protoDecoder) Decode(v interface{}) error {
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return err
+	}
+	if size > maxProtoMessageSize {
+		return fmt.Errorf("protobuf codec: message size %d exceeds limit", size)
+	}
+	b := make([]byte, size)
+	if _, err = io.ReadFull(d.r, b); err != nil {
+		return err
+	}
+
+	switch m := v.(type) {
+	case nil:
+		return nil
+	case *RequestHeader:
+		return m.unmarshalProto(b)
+	case *ResponseHeader:
+		return m.unmarshalProto(b)
+	case proto.Message:
+		return proto.Unmarshal(b, m)
+	default:
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+}
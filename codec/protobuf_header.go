@@ -0,0 +1,245 @@
+package codec
+
+import (
+	"errors"
+)
+
+import (
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 消息头的protobuf编码，字段编号与codec/morax.proto一致
+
+var errInvalidWireType = errors.New("protobuf codec: invalid wire type")
+
+// Marshal 按codec/morax.proto中的格式编码，帧协议中作为请求帧的元数据部分
+func (h *RequestHeader) Marshal() []byte {
+	return h.appendProto(nil)
+}
+
+func (h *RequestHeader) Unmarshal(b []byte) error {
+	*h = RequestHeader{}
+	return h.unmarshalProto(b)
+}
+
+// Marshal 按codec/morax.proto中的格式编码，帧协议中作为响应帧的元数据部分
+func (h *ResponseHeader) Marshal() []byte {
+	return h.appendProto(nil)
+}
+
+func (h *ResponseHeader) Unmarshal(b []byte) error {
+	*h = ResponseHeader{}
+	return h.unmarshalProto(b)
+}
+
+// MarshalMetadata 按codec/morax.proto中Metadata的格式编码，用于帧协议的元数据帧
+func MarshalMetadata(md metadata.MD) []byte {
+	return appendMap(nil, 1, md)
+}
+
+func UnmarshalMetadata(b []byte) (metadata.MD, error) {
+	md := metadata.MD{}
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		if num == 1 {
+			return consumeMapEntry(typ, v, md)
+		}
+		return -1, nil
+	})
+	return md, err
+}
+
+func (h *RequestHeader) appendProto(b []byte) []byte {
+	b = appendString(b, 1, h.ServiceMethod)
+	b = appendVarint(b, 2, h.Seq)
+	b = appendVarint(b, 3, uint64(h.Timeout))
+	return appendMap(b, 4, h.Meta)
+}
+
+func (h *RequestHeader) unmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, v, &h.ServiceMethod)
+		case 2:
+			return consumeVarint(typ, v, &h.Seq)
+		case 3:
+			var t uint64
+			n, err := consumeVarint(typ, v, &t)
+			h.Timeout = int64(t)
+			return n, err
+		case 4:
+			if h.Meta == nil {
+				h.Meta = metadata.MD{}
+			}
+			return consumeMapEntry(typ, v, h.Meta)
+		}
+		return -1, nil
+	})
+}
+
+func (h *ResponseHeader) appendProto(b []byte) []byte {
+	b = appendString(b, 1, h.ServiceMethod)
+	b = appendVarint(b, 2, h.Seq)
+	b = appendString(b, 3, h.Error)
+	if h.Status != nil {
+		var s []byte
+		s = appendString(s, 1, string(h.Status.Code))
+		s = appendString(s, 2, h.Status.Message)
+		s = appendMap(s, 3, h.Status.Details)
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	return appendMap(b, 5, h.Meta)
+}
+
+func (h *ResponseHeader) unmarshalProto(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, v, &h.ServiceMethod)
+		case 2:
+			return consumeVarint(typ, v, &h.Seq)
+		case 3:
+			return consumeString(typ, v, &h.Error)
+		case 4:
+			if typ != protowire.BytesType {
+				return 0, errInvalidWireType
+			}
+			s, n := protowire.ConsumeBytes(v)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			h.Status = &merr.Error{}
+			return n, unmarshalStatus(s, h.Status)
+		case 5:
+			if h.Meta == nil {
+				h.Meta = metadata.MD{}
+			}
+			return consumeMapEntry(typ, v, h.Meta)
+		}
+		return -1, nil
+	})
+}
+
+func unmarshalStatus(b []byte, e *merr.Error) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) (int, error) {
+		switch num {
+		case 1:
+			var code string
+			n, err := consumeString(typ, v, &code)
+			e.Code = merr.Code(code)
+			return n, err
+		case 2:
+			return consumeString(typ, v, &e.Message)
+		case 3:
+			if e.Details == nil {
+				e.Details = make(map[string]string)
+			}
+			return consumeMapEntry(typ, v, e.Details)
+		}
+		return -1, nil
+	})
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendMap map<string, string>，每个键值对编码为一个嵌套消息
+func appendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	for k, v := range m {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, v)
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// consumeFields 依次解析字段，f返回负数时跳过未知字段
+func consumeFields(b []byte, f func(num protowire.Number, typ protowire.Type, v []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := f(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return protowire.ParseError(n)
+			}
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeString(typ protowire.Type, b []byte, s *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, errInvalidWireType
+	}
+	v, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*s = v
+	return n, nil
+}
+
+func consumeVarint(typ protowire.Type, b []byte, x *uint64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, errInvalidWireType
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*x = v
+	return n, nil
+}
+
+func consumeMapEntry(typ protowire.Type, b []byte, m map[string]string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, errInvalidWireType
+	}
+	entry, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+
+	var k, v string
+	err := consumeFields(entry, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &k)
+		case 2:
+			return consumeString(typ, b, &v)
+		}
+		return -1, nil
+	})
+	m[k] = v
+	return n, err
+}
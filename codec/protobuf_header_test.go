@@ -0,0 +1,187 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+)
+
+import (
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestRequestHeader_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		h    RequestHeader
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "full",
+			h: RequestHeader{
+				ServiceMethod: "Hello.Hello",
+				Seq:           1<<64 - 1,
+				Timeout:       3000,
+				Meta:          metadata.MD{"trace-id": "abc", "empty": ""},
+			},
+		},
+		{
+			name: "without meta",
+			h:    RequestHeader{ServiceMethod: "Hello.Hello", Seq: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RequestHeader{ServiceMethod: "stale", Meta: metadata.MD{"stale": "1"}}
+			if err := got.Unmarshal(tt.h.Marshal()); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.h) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.h)
+			}
+		})
+	}
+}
+
+func TestResponseHeader_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		h    ResponseHeader
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "success",
+			h: ResponseHeader{
+				ServiceMethod: "Hello.Hello",
+				Seq:           42,
+				Meta:          metadata.MD{"server": "hello-1"},
+			},
+		},
+		{
+			name: "error string",
+			h:    ResponseHeader{ServiceMethod: "Hello.Hello", Seq: 1, Error: "rpc: can't find method"},
+		},
+		{
+			name: "status",
+			h: ResponseHeader{
+				ServiceMethod: "Hello.Hello",
+				Seq:           2,
+				Error:         "rpc error: code = NOT_FOUND, message = nope",
+				Status: &merr.Error{
+					Code:    merr.CodeNotFound,
+					Message: "nope",
+					Details: map[string]string{"a": "b", "c": "d"},
+				},
+			},
+		},
+		{
+			name: "status without details",
+			h: ResponseHeader{
+				Seq:    3,
+				Status: &merr.Error{Code: merr.CodeUnavailable},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResponseHeader{Error: "stale", Status: &merr.Error{Code: merr.CodeBusiness}}
+			if err := got.Unmarshal(tt.h.Marshal()); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.h) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.h)
+			}
+		})
+	}
+}
+
+func TestMetadata_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+	}{
+		{name: "nil", md: nil},
+		{name: "single", md: metadata.MD{"app": "hello"}},
+		{name: "multiple", md: metadata.MD{"app": "hello", "version": "1.0.0", "empty": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalMetadata(MarshalMetadata(tt.md))
+			if err != nil {
+				t.Fatalf("UnmarshalMetadata() error = %v", err)
+			}
+			want := tt.md
+			if want == nil {
+				want = metadata.MD{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("UnmarshalMetadata() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRequestHeader_Unmarshal(t *testing.T) {
+	valid := (&RequestHeader{ServiceMethod: "Hello.Hello", Seq: 1}).Marshal()
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    RequestHeader
+		wantErr bool
+	}{
+		{
+			name: "unknown fields skipped",
+			b: func() []byte {
+				b := protowire.AppendTag(nil, 15, protowire.VarintType)
+				b = protowire.AppendVarint(b, 1)
+				b = append(b, valid...)
+				b = protowire.AppendTag(b, 16, protowire.BytesType)
+				return protowire.AppendString(b, "ignored")
+			}(),
+			want: RequestHeader{ServiceMethod: "Hello.Hello", Seq: 1},
+		},
+		{
+			name: "invalid wire type",
+			b: func() []byte {
+				b := protowire.AppendTag(nil, 1, protowire.VarintType)
+				return protowire.AppendVarint(b, 1)
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			b:       valid[:len(valid)-1],
+			wantErr: true,
+		},
+		{
+			name:    "bad tag",
+			b:       []byte{0x80},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got RequestHeader
+			err := got.Unmarshal(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package constants
+
+// 熔断级别
+const (
+	// BreakerLevelInstance 按实例熔断，熔断的实例不参与负载均衡
+	BreakerLevelInstance = "instance"
+	// BreakerLevelMethod 按方法熔断，熔断时该方法的调用直接失败
+	BreakerLevelMethod = "method"
+)
+
+const DefaultBreakerLevel = BreakerLevelInstance
+
+// DefaultBreakerWindow 错误率统计窗口的默认值，单位毫秒
+const DefaultBreakerWindow = 10000
+
+// DefaultBreakerCooldown 熔断后转为半开前的默认冷却时间，单位毫秒
+const DefaultBreakerCooldown = 5000
+
+// DefaultBreakerMinRequests 按错误率熔断时统计窗口内的默认最小请求数
+const DefaultBreakerMinRequests = 10
@@ -0,0 +1,44 @@
+package constants
+
+import "time"
+
+const (
+	FailoverCluster  = "failover"
+	FailfastCluster  = "failfast"
+	FailsafeCluster  = "failsafe"
+	FailbackCluster  = "failback"
+	ForkingCluster   = "forking"
+	BroadcastCluster = "broadcast"
+)
+
+const DefaultCluster = FailoverCluster
+
+// DefaultForks forking模式下默认并行调用的实例数
+const DefaultForks = 2
+
+// DefaultFailbackRetries failback模式下未配置重试次数时的后台重试次数
+const DefaultFailbackRetries = 3
+
+// FailbackRetryInterval failback模式下后台重试的间隔
+const FailbackRetryInterval = 5 * time.Second
+
+// DefaultFailbackQueueSize failback模式下等待重试的失败请求数上限，超出时丢弃
+const DefaultFailbackQueueSize = 1000
+
+// 重试退避策略
+const (
+	NoBackoff                = "none"
+	FixedBackoff             = "fixed"
+	ExponentialBackoff       = "exponential"
+	ExponentialJitterBackoff = "exponential_jitter"
+)
+
+// 可重试的错误类型
+const (
+	// RetryOnConnection 链接错误，如无法建立链接、链接已关闭
+	RetryOnConnection = "connection"
+	// RetryOnTimeout 调用超时
+	RetryOnTimeout = "timeout"
+	// RetryOnRemote 提供者返回的错误
+	RetryOnRemote = "remote"
+)
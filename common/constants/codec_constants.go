@@ -0,0 +1,21 @@
+package constants
+
+// 编解码器
+const (
+	JsonCodec     = "json"
+	GobCodec      = "gob"
+	MsgpackCodec  = "msgpack"
+	ProtobufCodec = "protobuf"
+	DefaultCodec  = JsonCodec
+)
+
+// 编解码器编号，用于帧协议的帧头
+const (
+	JsonCodecId     uint8 = 1
+	GobCodecId      uint8 = 2
+	MsgpackCodecId  uint8 = 3
+	ProtobufCodecId uint8 = 4
+)
+
+// CodecPreface 流式协议中，消费者建立链接后写入的协商前缀，其后为编解码器名称与换行符，未写入时使用json
+const CodecPreface = "MORAX "
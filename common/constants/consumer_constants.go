@@ -1,4 +1,12 @@
 package constants
 
+import "time"
+
 const DefaultLoadBalance = "random"
 const DefaultTimeOut = 800
+
+// ReconnectInterval 与提供者建立链接失败或链接断开后的重试间隔
+const ReconnectInterval = time.Second
+
+// DialTimeout 与提供者建立链接（含协商前缀与链接元数据的写出）的超时时间
+const DialTimeout = 3 * time.Second
@@ -0,0 +1,11 @@
+package constants
+
+// 降级方式
+const (
+	// MockFail 调用最终失败时调用降级处理函数
+	MockFail = "fail"
+	// MockForce 不调用提供者，直接调用降级处理函数
+	MockForce = "force"
+)
+
+const DefaultMock = MockFail
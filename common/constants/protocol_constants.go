@@ -0,0 +1,17 @@
+package constants
+
+// 通信协议
+const (
+	// ProtocolMorax 帧协议，支持心跳、压缩与元数据帧
+	ProtocolMorax = "morax"
+	// ProtocolStream 流式协议，json或写入协商前缀后使用的编解码器
+	ProtocolStream = "stream"
+	// DefaultProtocol 未配置协议且实例未声明支持帧协议时使用的协议，兼容只支持流式协议的提供者
+	DefaultProtocol = ProtocolStream
+)
+
+// DefaultHeartbeat 帧协议的心跳间隔，单位毫秒
+const DefaultHeartbeat = 30000
+
+// ConnMetaCaller 帧协议中消费者在元数据帧中携带的调用方服务名
+const ConnMetaCaller = "caller"
@@ -0,0 +1,24 @@
+package constants
+
+const (
+	ConsulRegistry  = "consul"
+	MemoryRegistry  = "memory"
+	FileRegistry    = "file"
+	EtcdRegistry    = "etcd"
+	DefaultRegistry = ConsulRegistry
+)
+
+// 服务元数据中的保留key
+const (
+	MetaVersion = "version"
+	MetaGroup   = "group"
+	// MetaCodecs 提供者支持的编解码器，以逗号分隔
+	MetaCodecs = "codecs"
+	// MetaProtocols 提供者支持的通信协议，以逗号分隔
+	MetaProtocols = "protocols"
+)
+
+const (
+	DefaultEtcdPrefix = "/morax/"
+	DefaultEtcdTTL    = 10
+)
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+// BackoffDelay 计算第attempt次重试（从1开始）前的等待时间，maxDelay不大于0时不限制
+func BackoffDelay(backoffType string, delay, maxDelay time.Duration, attempt int) time.Duration {
+	var d time.Duration
+	switch backoffType {
+	case constants.FixedBackoff:
+		d = delay
+	case constants.ExponentialBackoff, constants.ExponentialJitterBackoff:
+		d = delay
+		for i := 1; i < attempt; i++ {
+			// 达到上限或即将溢出时不再翻倍
+			if (maxDelay > 0 && d >= maxDelay) || d > math.MaxInt64/2 {
+				break
+			}
+			d *= 2
+		}
+	default:
+		return 0
+	}
+
+	if maxDelay > 0 && d > maxDelay {
+		d = maxDelay
+	}
+
+	// full jitter：在[0, d]中随机选取
+	if backoffType == constants.ExponentialJitterBackoff && d > 0 {
+		d = time.Duration(rand.Int63n(int64(d) + 1))
+	}
+	return d
+}
@@ -5,13 +5,29 @@ type ConsumerConfig struct {
 }
 
 type ReferenceConfig struct {
-	ConfInfo  `mapstructure:",squash"`
+	ConfInfo `mapstructure:",squash"`
+	// Codec 与提供者通信使用的编解码器：json、gob、msgpack、protobuf
+	Codec string `mapstructure:"codec"`
+	// Protocol 与提供者通信使用的协议：morax 帧协议；stream 流式协议
+	Protocol string `mapstructure:"protocol"`
+	// Heartbeat 帧协议的心跳间隔，单位毫秒，小于0时不发送心跳
+	Heartbeat int                              `mapstructure:"heartbeat"`
 	Providers map[string]ProviderServiceConfig `mapstructure:"providers"`
 }
 
 type ProviderServiceConfig struct {
 	ConfInfo `mapstructure:",squash"`
-	Methods  map[string]MethodConfig `mapstructure:"methods"`
+	// Urls 直连的提供者地址列表，格式为host:port，配置后不通过注册中心发现实例
+	Urls []string `mapstructure:"urls"`
+	// Version 消费的提供者版本，为空或"*"时不限制版本，以"*"结尾时按前缀匹配
+	Version string `mapstructure:"version"`
+	// Group 消费的提供者分组，仅匹配分组相同的实例，"*"时不限制分组
+	Group string `mapstructure:"group"`
+	// Codec Protocol Heartbeat 与该提供者通信的配置，未配置时继承reference的配置
+	Codec     string                  `mapstructure:"codec"`
+	Protocol  string                  `mapstructure:"protocol"`
+	Heartbeat int                     `mapstructure:"heartbeat"`
+	Methods   map[string]MethodConfig `mapstructure:"methods"`
 }
 
 type MethodConfig struct {
@@ -23,4 +39,28 @@ type ConfInfo struct {
 	Retries int    `mapstructure:"retries"`
 	Timeout int    `mapstructure:"timeout"`
 	Cluster string `mapstructure:"cluster"`
+	// Forks forking模式下并行调用的实例数
+	Forks int `mapstructure:"forks"`
+	// Backoff 重试退避策略：none、fixed、exponential、exponential_jitter
+	Backoff string `mapstructure:"backoff"`
+	// BackoffDelay 退避基础时间，单位毫秒
+	BackoffDelay int `mapstructure:"backoffDelay"`
+	// BackoffMaxDelay 退避最大时间，单位毫秒
+	BackoffMaxDelay int `mapstructure:"backoffMaxDelay"`
+	// RetryOn 可重试的错误类型：connection、timeout、remote，或提供者返回的错误码，如unavailable
+	RetryOn []string `mapstructure:"retryOn"`
+	// BreakerFailures 连续失败次数达到此值时熔断，0表示不按连续失败熔断
+	BreakerFailures int `mapstructure:"breakerFailures"`
+	// BreakerErrorRate 统计窗口内错误率（百分比）达到此值时熔断，0表示不按错误率熔断
+	BreakerErrorRate int `mapstructure:"breakerErrorRate"`
+	// BreakerMinRequests 统计窗口内请求数达到此值时才按错误率熔断
+	BreakerMinRequests int `mapstructure:"breakerMinRequests"`
+	// BreakerWindow 错误率统计窗口，单位毫秒
+	BreakerWindow int `mapstructure:"breakerWindow"`
+	// BreakerCooldown 熔断后转为半开前的冷却时间，单位毫秒
+	BreakerCooldown int `mapstructure:"breakerCooldown"`
+	// BreakerLevel 熔断级别：instance、method
+	BreakerLevel string `mapstructure:"breakerLevel"`
+	// Mock 降级方式：fail 调用失败时降级；force 不调用提供者，直接降级
+	Mock string `mapstructure:"mock"`
 }
@@ -15,7 +15,10 @@ import (
 	cr "github.com/ForeverSRC/morax/config/registry"
 	cs "github.com/ForeverSRC/morax/config/service"
 	"github.com/ForeverSRC/morax/logger"
-	"github.com/ForeverSRC/morax/registry/consul"
+	_ "github.com/ForeverSRC/morax/registry/consul"
+	_ "github.com/ForeverSRC/morax/registry/etcd"
+	_ "github.com/ForeverSRC/morax/registry/file"
+	_ "github.com/ForeverSRC/morax/registry/memory"
 	"github.com/ForeverSRC/morax/service"
 )
 
@@ -28,7 +31,6 @@ var v = viper.New()
 func Load(ctx context.Context) *service.MoraxService {
 	loadConf()
 	initLogger()
-	initRegistryClient()
 
 	return initMoraxService(ctx)
 }
@@ -37,6 +39,7 @@ func initMoraxService(ctx context.Context) *service.MoraxService {
 	ms := new(service.MoraxService)
 
 	initServiceInfo(ms, ctx)
+	initRegistry(ms)
 	initHealthCheck(ms)
 	initConsumer(ms)
 	initProvider(ms)
@@ -102,7 +105,7 @@ func initServiceInfo(ms *service.MoraxService, ctx context.Context) {
 
 func initHealthCheck(ms *service.MoraxService) {
 	ckf := &ck.CheckConfig{}
-	res, err := genConfigInfo("check", ckf, false)
+	res, err := genConfigInfo("check", ckf, true)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -113,9 +116,9 @@ func initHealthCheck(ms *service.MoraxService) {
 	ms.InitHealthCheck(ckf)
 }
 
-func initRegistryClient() {
-	dcf := &cr.ConsulClientConfig{}
-	res, err := genConfigInfo("registries", dcf, false)
+func initRegistry(ms *service.MoraxService) {
+	rcf := &cr.RegistryConfig{}
+	res, err := genConfigInfo("registries", rcf, false)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -123,7 +126,10 @@ func initRegistryClient() {
 		return
 	}
 
-	consul.NewClient(dcf)
+	err = ms.InitRegistry(rcf)
+	if err != nil {
+		log.Fatal("init registry error: ", err)
+	}
 }
 
 func initConsumer(ms *service.MoraxService) {
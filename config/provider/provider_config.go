@@ -2,6 +2,8 @@ package provider
 
 type ServiceConfig struct {
 	Port int `mapstructure:"port"`
+	// Codecs 接受的编解码器，未配置时接受所有编解码器
+	Codecs []string `mapstructure:"codecs"`
 }
 
 type ProviderConfig struct {
@@ -1,6 +0,0 @@
-package registry
-
-type ConsulClientConfig struct {
-	Addr        string `mapstructure:"addr"`
-	WaitTimeout int    `mapstructure:"waitTimeout"`
-}
@@ -0,0 +1,27 @@
+package registry
+
+type RegistryConfig struct {
+	// Type 注册中心类型，默认为consul
+	Type               string `mapstructure:"type"`
+	ConsulClientConfig `mapstructure:",squash"`
+	FileConfig         `mapstructure:",squash"`
+	EtcdConfig         `mapstructure:",squash"`
+}
+
+type ConsulClientConfig struct {
+	Addr        string `mapstructure:"addr"`
+	WaitTimeout int    `mapstructure:"waitTimeout"`
+}
+
+type FileConfig struct {
+	// Path 存储服务实例的文件或目录
+	Path string `mapstructure:"path"`
+}
+
+type EtcdConfig struct {
+	Endpoints []string `mapstructure:"endpoints"`
+	// Prefix 服务实例键的前缀，默认为/morax/
+	Prefix string `mapstructure:"prefix"`
+	// TTL 租约时长，单位为秒
+	TTL int `mapstructure:"ttl"`
+}
@@ -3,4 +3,11 @@ package service
 type ServiceConfig struct {
 	Name string `mapstructure:"name"`
 	Host string `mapstructure:"host"`
+	// Version Group 服务版本与分组，消费者据此选择实例
+	Version string `mapstructure:"version"`
+	Group   string `mapstructure:"group"`
+	// Tags 注册到注册中心的服务标签
+	Tags []string `mapstructure:"tags"`
+	// Meta 注册到注册中心的服务元数据，如version、zone、weight、protocol
+	Meta map[string]string `mapstructure:"meta"`
 }
@@ -0,0 +1,100 @@
+package consumer
+
+import (
+	"bufio"
+	"io"
+	"net/rpc"
+	"sync"
+)
+
+import (
+	"github.com/ForeverSRC/morax/codec"
+)
+
+// BinaryClientCodec 使用二进制编解码器的客户端编解码器，参考net/rpc包中的gobClientCodec
+// 每条消息依次为消息头与消息体，请求头中携带调用方剩余的时间预算与元数据
+type BinaryClientCodec struct {
+	dec    codec.Decoder
+	enc    codec.Encoder
+	encBuf *bufio.Writer
+	c      io.Closer
+
+	resp codec.ResponseHeader
+
+	mutex sync.Mutex // protects calls
+	// calls 请求id->携带调用信息的入参，用于回填响应元数据与结构化错误
+	calls map[uint64]*callArgs
+}
+
+func NewBinaryClientCodec(conn io.ReadWriteCloser, cd codec.Codec) rpc.ClientCodec {
+	buf := bufio.NewWriter(conn)
+	return &BinaryClientCodec{
+		dec:    cd.NewDecoder(conn),
+		enc:    cd.NewEncoder(buf),
+		encBuf: buf,
+		c:      conn,
+		calls:  make(map[uint64]*callArgs),
+	}
+}
+
+// WriteRequest 由rpc.Client加锁后调用
+func (c *BinaryClientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	h := codec.RequestHeader{ServiceMethod: r.ServiceMethod, Seq: r.Seq}
+	body := param
+	if ca, ok := param.(*callArgs); ok {
+		body = ca.args
+		if !ca.deadline.IsZero() {
+			h.Timeout = remainingMillis(ca.deadline)
+		}
+		h.Meta = ca.md
+		c.mutex.Lock()
+		c.calls[r.Seq] = ca
+		c.mutex.Unlock()
+	}
+
+	err := c.enc.Encode(&h)
+	if err == nil {
+		err = c.enc.Encode(body)
+	}
+	if err == nil {
+		err = c.encBuf.Flush()
+	}
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.calls, r.Seq)
+		c.mutex.Unlock()
+	}
+	return err
+}
+
+func (c *BinaryClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	c.resp = codec.ResponseHeader{}
+	if err := c.dec.Decode(&c.resp); err != nil {
+		return err
+	}
+	r.ServiceMethod = c.resp.ServiceMethod
+	r.Seq = c.resp.Seq
+	r.Error = c.resp.Error
+
+	c.mutex.Lock()
+	ca, ok := c.calls[r.Seq]
+	delete(c.calls, r.Seq)
+	c.mutex.Unlock()
+
+	if ok {
+		if ca.resp != nil && len(c.resp.Meta) > 0 {
+			ca.resp.Set(c.resp.Meta)
+		}
+		ca.remoteErr = c.resp.Status
+	}
+	return nil
+}
+
+// ReadResponseBody x为nil时丢弃响应体
+func (c *BinaryClientCodec) ReadResponseBody(x interface{}) error {
+	return c.dec.Decode(x)
+}
+
+func (c *BinaryClientCodec) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,290 @@
+package consumer
+
+// 在net/rpc/jsonrpc 包基础上进行改进，请求中携带调用方剩余的时间预算与元数据，响应中携带元数据与结构化错误
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/codec"
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/common/types"
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+type JsonClientCodec struct {
+	dec *json.Decoder // for reading JSON values
+	enc *json.Encoder // for writing JSON values
+	c   io.Closer
+
+	// temporary work space
+	req  clientRequest
+	resp clientResponse
+
+	mutex   sync.Mutex        // protects pending, calls
+	pending map[uint64]string // map request id to method name
+	// calls 请求id->携带调用信息的入参，用于回填响应元数据与结构化错误
+	calls map[uint64]*callArgs
+}
+
+func NewJsonClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &JsonClientCodec{
+		dec:     json.NewDecoder(conn),
+		enc:     json.NewEncoder(conn),
+		c:       conn,
+		pending: make(map[uint64]string),
+		calls:   make(map[uint64]*callArgs),
+	}
+}
+
+// callArgs 携带调用信息的入参，由编解码器展开后写入请求
+type callArgs struct {
+	args interface{}
+	// deadline 调用方放弃等待的时间
+	deadline time.Time
+	// md 请求元数据
+	md metadata.MD
+	// resp 接收响应元数据，可以为nil
+	resp *metadata.Response
+	// remoteErr 提供者返回的结构化错误，在调用完成前由编解码器设置
+	remoteErr *merr.Error
+}
+
+type clientRequest struct {
+	Method string         `json:"method"`
+	Params [1]interface{} `json:"params"`
+	Id     uint64         `json:"id"`
+	// Timeout 调用方剩余的时间预算，单位毫秒，使用相对时间避免两端时钟不一致
+	Timeout int64 `json:"timeout,omitempty"`
+	// Meta 请求元数据
+	Meta metadata.MD `json:"meta,omitempty"`
+}
+
+func (c *JsonClientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	c.mutex.Lock()
+	c.pending[r.Seq] = r.ServiceMethod
+	c.mutex.Unlock()
+	c.req.Method = r.ServiceMethod
+	c.req.Id = r.Seq
+	c.req.Timeout = 0
+	c.req.Meta = nil
+	if ca, ok := param.(*callArgs); ok {
+		c.req.Params[0] = ca.args
+		if !ca.deadline.IsZero() {
+			c.req.Timeout = remainingMillis(ca.deadline)
+		}
+		c.req.Meta = ca.md
+		c.mutex.Lock()
+		c.calls[r.Seq] = ca
+		c.mutex.Unlock()
+	} else {
+		c.req.Params[0] = param
+	}
+
+	if err := c.enc.Encode(&c.req); err != nil {
+		c.mutex.Lock()
+		delete(c.calls, r.Seq)
+		c.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+type clientResponse struct {
+	Id     uint64           `json:"id"`
+	Result *json.RawMessage `json:"result"`
+	Error  *json.RawMessage `json:"error"`
+	// Status 提供者返回的结构化错误，可以为空
+	Status *merr.Error `json:"status"`
+	Meta   metadata.MD `json:"meta"`
+}
+
+func (r *clientResponse) reset() {
+	r.Id = 0
+	r.Result = nil
+	r.Error = nil
+	r.Status = nil
+	r.Meta = nil
+}
+
+func (c *JsonClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	c.resp.reset()
+	if err := c.dec.Decode(&c.resp); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	r.ServiceMethod = c.pending[c.resp.Id]
+	delete(c.pending, c.resp.Id)
+	ca, ok := c.calls[c.resp.Id]
+	delete(c.calls, c.resp.Id)
+	c.mutex.Unlock()
+
+	if ok && ca.resp != nil && len(c.resp.Meta) > 0 {
+		ca.resp.Set(c.resp.Meta)
+	}
+
+	r.Error = ""
+	r.Seq = c.resp.Id
+	if c.resp.Status != nil && c.resp.Status.Code != "" {
+		if ok {
+			ca.remoteErr = c.resp.Status
+		}
+		r.Error = c.resp.Status.Error()
+	} else if c.resp.Error != nil || c.resp.Result == nil {
+		x, e, err := parseError(c.resp.Error)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ca.remoteErr = e
+		}
+		r.Error = x
+	}
+	return nil
+}
+
+// parseError 解析响应中的错误，可以是字符串或结构化错误
+func parseError(raw *json.RawMessage) (string, *merr.Error, error) {
+	if raw == nil {
+		return "unspecified error", nil, nil
+	}
+
+	var x string
+	if err := json.Unmarshal(*raw, &x); err == nil {
+		if x == "" {
+			x = "unspecified error"
+		}
+		return x, nil, nil
+	}
+
+	e := &merr.Error{}
+	if err := json.Unmarshal(*raw, e); err != nil || e.Code == "" {
+		return "", nil, fmt.Errorf("invalid error %s", string(*raw))
+	}
+	return e.Error(), e, nil
+}
+
+func (c *JsonClientCodec) ReadResponseBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	return json.Unmarshal(*c.resp.Result, x)
+}
+
+func (c *JsonClientCodec) Close() error {
+	return c.c.Close()
+}
+
+// remainingMillis 距deadline的剩余毫秒数，已过期时为1，交由提供者拒绝
+func remainingMillis(deadline time.Time) int64 {
+	ms := int64(time.Until(deadline) / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return ms
+}
+
+// dialOptions 与提供者实例建立链接的参数
+type dialOptions struct {
+	protocol string
+	codec    string
+	// heartbeat 帧协议的心跳间隔
+	heartbeat time.Duration
+	// connMeta 帧协议中链接建立后发送的链接元数据
+	connMeta metadata.MD
+	// onBroken 链接断开（如心跳超时、提供者关闭链接）时调用一次
+	onBroken func()
+}
+
+// trackedCodec 记录链接是否已断开
+// rpc.Client读取响应出错后不再可用，此后的调用均返回rpc.ErrShutdown，需要重新建立链接
+type trackedCodec struct {
+	rpc.ClientCodec
+	broken     types.AtomicBool
+	onBroken   func()
+	brokenOnce sync.Once
+}
+
+func (c *trackedCodec) ReadResponseHeader(r *rpc.Response) error {
+	err := c.ClientCodec.ReadResponseHeader(r)
+	if err != nil {
+		c.setBroken()
+	}
+	return err
+}
+
+// ReadResponseBody x为replyTarget时解码到调用方传入的reply指针
+func (c *trackedCodec) ReadResponseBody(x interface{}) error {
+	var err error
+	if t, ok := x.(*replyTarget); ok {
+		err = t.read(c.ClientCodec)
+	} else {
+		err = c.ClientCodec.ReadResponseBody(x)
+	}
+	if err != nil {
+		c.setBroken()
+	}
+	return err
+}
+
+func (c *trackedCodec) Close() error {
+	c.setBroken()
+	return c.ClientCodec.Close()
+}
+
+func (c *trackedCodec) setBroken() {
+	c.broken.SetTrue()
+	c.brokenOnce.Do(func() {
+		if c.onBroken != nil {
+			c.onBroken()
+		}
+	})
+}
+
+// dial 建立链接，返回rpc client及其使用的编解码器，建立链接超过DialTimeout时返回错误
+// 帧协议中链接建立后发送链接元数据；流式协议中使用json以外的编解码器时先写入协商前缀
+func dial(target string, opts dialOptions) (*rpc.Client, *trackedCodec, error) {
+	cd, err := codec.GetCodec(opts.codec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", target, constants.DialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 协商前缀与链接元数据的写出同样受超时限制
+	_ = conn.SetWriteDeadline(time.Now().Add(constants.DialTimeout))
+
+	tc := &trackedCodec{onBroken: opts.onBroken}
+	switch {
+	case opts.protocol == constants.ProtocolMorax:
+		fc := NewFramedClientCodec(conn, cd, opts.heartbeat)
+		if len(opts.connMeta) > 0 {
+			if err = fc.SendMetadata(opts.connMeta); err != nil {
+				_ = fc.Close()
+				return nil, nil, err
+			}
+		}
+		tc.ClientCodec = fc
+	case opts.codec == constants.JsonCodec:
+		tc.ClientCodec = NewJsonClientCodec(conn)
+	default:
+		if _, err = io.WriteString(conn, constants.CodecPreface+opts.codec+"\n"); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+		tc.ClientCodec = NewBinaryClientCodec(conn, cd)
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+	return rpc.NewClientWithCodec(tc), tc, nil
+}
@@ -6,14 +6,19 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
-	"time"
 )
 
 import (
+	"github.com/ForeverSRC/morax/breaker"
+	"github.com/ForeverSRC/morax/cluster"
+	"github.com/ForeverSRC/morax/common/constants"
 	"github.com/ForeverSRC/morax/common/types"
+	"github.com/ForeverSRC/morax/common/utils"
 	cc "github.com/ForeverSRC/morax/config/consumer"
 	. "github.com/ForeverSRC/morax/error"
 	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/metadata"
+	"github.com/ForeverSRC/morax/registry"
 )
 
 type RpcConsumer struct {
@@ -24,37 +29,68 @@ type RpcConsumer struct {
 	mu             sync.Mutex
 	ctx            context.Context
 	allClientClose bool
+	// watching 已开始监听提供者，此后新订阅的提供者立即开始监听
+	watching bool
+	// fallbacks 降级处理函数 provider.method->函数，method为空时对提供者的所有方法生效
+	fallbacks map[string]Fallback
+	fbMu      sync.RWMutex
+	// interceptors 对所有提供者生效的拦截器
+	interceptors []Interceptor
+	// providerInterceptors 对指定提供者生效的拦截器 providerName->拦截器
+	providerInterceptors map[string][]Interceptor
+	icMu                 sync.RWMutex
+	// reg 服务发现使用的注册中心
+	reg registry.Registry
+	// connMeta 帧协议中链接建立后发送的链接元数据
+	connMeta metadata.MD
+	// retryQueue failback模式下失败请求的重试队列，关机时排空
+	retryQueue *cluster.RetryQueue
+	// generics 泛化调用解析后的方法 provider.method->方法
+	generics map[string]*genericMethod
+	gmMu     sync.RWMutex
 }
 
-func NewRpcConsumer(ctx context.Context, config *cc.ConsumerConfig) *RpcConsumer {
+func NewRpcConsumer(ctx context.Context, config *cc.ConsumerConfig, reg registry.Registry) *RpcConsumer {
 	con := &RpcConsumer{
-		conf:      config,
-		providers: make(map[string]*ProviderInstances),
-		ctx:       ctx,
+		conf:                 config,
+		providers:            make(map[string]*ProviderInstances),
+		fallbacks:            make(map[string]Fallback),
+		providerInterceptors: make(map[string][]Interceptor),
+		generics:             make(map[string]*genericMethod),
+		ctx:                  ctx,
+		reg:                  reg,
+		retryQueue:           cluster.NewRetryQueue(ctx, constants.DefaultFailbackQueueSize),
 	}
 	con.inShutdown.SetFalse()
 	return con
 }
 
+// SetConnMetadata 设置帧协议中链接建立后发送给提供者的链接元数据，需在注册消费的方法前调用
+func (c *RpcConsumer) SetConnMetadata(md metadata.MD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connMeta = md
+}
+
 func (c *RpcConsumer) Shutdown() {
 	// 设置标志位
 	c.inShutdown.SetTrue()
+	// 排空failback的失败请求队列，在关闭链接前完成剩余的重试
+	c.retryQueue.Drain()
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	// 关闭所有rpc client
-	// net/rpc包中 Client的close方法会通过加锁的机制，阻塞等待当前send完成
-	c.closeAllClientLock()
-	// 停止所有watcher
+	// 停止所有watcher，此后不再重新建立链接
 	for _, p := range c.providers {
 		p.Cancel()
 	}
+	// 关闭所有rpc client
+	// net/rpc包中 Client的close方法会通过加锁的机制，阻塞等待当前send完成
+	c.closeAllClientLock()
 }
 
 func (c *RpcConsumer) closeAllClientLock() {
 	for _, p := range c.providers {
-		for _, client := range p.instances {
-			_ = client.Close()
-		}
+		p.closeAll()
 	}
 	c.allClientClose = true
 }
@@ -66,10 +102,13 @@ func (c *RpcConsumer) RegisterConsumer(name string, service interface{}) error {
 		return errors.New("invalid consumer service type")
 	}
 
+	// 设置监听
+	pss := c.subscribe(name)
+
 	for i := 0; i < s.NumField(); i++ {
 		// 函数
 		field := s.Field(i)
-		rTyp, er := checkMethodField(&field)
+		st, er := checkMethodField(&field)
 		if er != nil {
 			logger.Error("check method field error: %s", er)
 			continue
@@ -83,171 +122,299 @@ func (c *RpcConsumer) RegisterConsumer(name string, service interface{}) error {
 			ProviderName: name,
 			MethodName:   methodName,
 		}
-		// 获取当前方法的配置：负载均衡策略，超时重试
+		// 获取当前方法的配置：负载均衡策略，超时重试，集群容错策略
 		info.SetConfigInfo(c.conf)
 
-		mf := reflect.MakeFunc(field.Type(), func(args []reflect.Value) []reflect.Value {
+		mf := reflect.MakeFunc(field.Type(), func(args []reflect.Value) (results []reflect.Value) {
+			defer func() {
+				if e := recover(); e != nil {
+					logger.Error("recover: rpc call panic:%v", e)
+					results = st.results(nil, fmt.Errorf("rpc call panic: %v", e))
+				}
+			}()
+
 			// consumer处于shutdown阶段时停止一切调用，返回错误
 			if c.inShutdown.IsSet() {
-				return []reflect.Value{reflect.Zero(*rTyp), reflect.ValueOf(RpcError{
-					Err: fmt.Errorf("consumer is shutting down"),
-				})}
+				return st.results(nil, ErrShutdown)
 			}
 
-			callSuccessCh := make(chan []reflect.Value)
-			callFailCh := make(chan error)
-			defer close(callFailCh)
-			defer close(callSuccessCh)
-
-			core := func(ctx context.Context) <-chan []reflect.Value {
-				defer func() {
-					if e := recover(); e != nil {
-						logger.Error("recover: rpc call panic:%v", e)
-					}
-				}()
-
-				parseErr := func(err error) {
-					callFailCh <- err
-				}
-
-				resCh := make(chan []reflect.Value, 1)
-				// 服务发现
-				providerInstances, ok := c.providers[name]
-				if !ok {
-					parseErr(errors.New("no instance of provider: " + name))
-				}
-
-				// 负载均衡
-				client, err := providerInstances.LoadBalance(info.LBType)
-				if err != nil {
-					parseErr(err)
-					return nil
-				}
-
-				// 调用
-				resp := reflect.New(*rTyp) //a pointer
-				err = client.Call(serviceMethod, args[0].Interface(), resp.Interface())
-				if err != nil {
-					parseErr(err)
-					return nil
+			// 使用调用方传入的context，遵循其deadline与取消
+			ctx := c.ctx
+			if st.withCtx {
+				if callerCtx, ok := args[0].Interface().(context.Context); ok && callerCtx != nil {
+					ctx = callerCtx
 				}
-
-				resCh <- []reflect.Value{resp.Elem(), reflect.Zero(reflect.TypeOf(RpcError{}))}
-				return resCh
 			}
 
-			invoke := func(ctx context.Context, timer *time.Timer, isRetry bool) {
-				if isRetry {
-					timer.Reset(time.Millisecond * time.Duration(info.Timeout))
-				}
-
-				select {
-				case res := <-core(ctx):
-					callSuccessCh <- res
-					return
-				case <-ctx.Done():
-					return
-				}
-
+			inv := &rpcInvocation{
+				info:          &info,
+				serviceMethod: serviceMethod,
+				ps:            pss,
+				args:          args[st.argsIndex()].Interface(),
+				replyType:     st.replyType,
+				retryQueue:    c.retryQueue,
 			}
 
-			// 实际调用过程
-			callCtx, callCancel := context.WithCancel(c.ctx)
-			count := 0
-			timer := time.NewTimer(time.Millisecond * time.Duration(info.Timeout))
-			go invoke(callCtx, timer, false)
-
-			for {
-				select {
-				case res := <-callSuccessCh:
-					{
-						timer.Stop()
-						callCancel()
-						return res
-
-					}
-				case fail := <-callFailCh:
-					{
-						timer.Stop()
-						callCancel()
-						// todo: 失败重试
-						if count < info.Retries {
-							count++
-							callCtx, callCancel = context.WithCancel(c.ctx)
-							go invoke(callCtx, timer, true)
-						} else {
-							return []reflect.Value{reflect.Zero(*rTyp), reflect.ValueOf(RpcError{
-								Err: fail,
-							})}
-						}
-					}
-				case <-timer.C:
-					{
-						timer.Stop()
-						callCancel()
-						// todo: 超时重试
-						if count < info.Retries {
-							count++
-							callCtx, callCancel = context.WithCancel(c.ctx)
-							go invoke(callCtx, timer, true)
-						} else {
-							return []reflect.Value{reflect.Zero(*rTyp), reflect.ValueOf(RpcError{Err: errors.New("rpc call time out")})}
+			if st.async {
+				reply := args[len(args)-1]
+				if reply.IsNil() {
+					return st.results(nil, errors.New("reply must not be nil"))
+				}
+				// 响应直接解码到reply，不经过临时值的复制，protobuf消息等含内部状态的类型可以安全使用
+				inv.target = &replyTarget{ptr: reply}
+				f := newFuture()
+				go func() {
+					var err error
+					defer func() {
+						if e := recover(); e != nil {
+							logger.Error("recover: rpc call panic:%v", e)
+							err = fmt.Errorf("rpc call panic: %v", e)
 						}
+						inv.target.close()
+						f.complete(err)
+					}()
+
+					var res interface{}
+					res, err = c.invoke(ctx, inv)
+					inv.target.close()
+					// 降级处理函数或拦截器替换了返回值时，复制到reply
+					if res != nil && err == nil && reflect.ValueOf(res).Pointer() != reply.Pointer() {
+						reply.Elem().Set(reflect.ValueOf(res).Elem())
 					}
-				}
+				}()
+				return []reflect.Value{reflect.ValueOf(f)}
 			}
+
+			// 按集群容错策略进行调用，容错策略忽略错误时res为nil，返回零值
+			res, err := c.invoke(ctx, inv)
+			return st.results(res, err)
 		})
 
 		field.Set(mf)
 	}
 
-	// 设置监听
-	if _, ok := c.providers[name]; !ok {
-		pss := NewProviderInstances(name)
-		ctx, cancel := context.WithCancel(c.ctx)
-		pss.Ctx = ctx
-		pss.Cancel = cancel
-		c.providers[name] = pss
+	return nil
+}
+
+// doInvoke 按集群容错策略进行调用
+// 启用方法级熔断时，熔断期间直接返回breaker.ErrOpen，调用结果计入熔断统计
+func doInvoke(ctx context.Context, inv *rpcInvocation) (res interface{}, err error) {
+	if b := inv.methodBreaker(); b != nil {
+		if !b.Allow() {
+			return nil, breaker.ErrOpen
+		}
+		defer func() {
+			recordBreaker(ctx, b, err)
+		}()
 	}
 
-	return nil
+	return cluster.DoInvoke(ctx, inv.info.Cluster, inv)
+}
+
+// StaticOnly 订阅的提供者均配置了直连地址，不依赖注册中心
+func (c *RpcConsumer) StaticOnly() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.providers {
+		if len(p.urls) == 0 {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *RpcConsumer) StartWatch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.watching = true
 	for _, v := range c.providers {
 		go v.StartWatcher()
 	}
 }
 
-func checkMethodField(field *reflect.Value) (*reflect.Type, error) {
+// subscribe 返回订阅的提供者集群，不存在时创建
+// 已开始监听时，新订阅的提供者立即开始监听
+func (c *RpcConsumer) subscribe(name string) *ProviderInstances {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pss, ok := c.providers[name]
+	if ok {
+		return pss
+	}
+
+	pss = NewProviderInstances(name, c.reg)
+	ref := c.conf.Reference
+	codecName, protocol, heartbeat := ref.Codec, ref.Protocol, ref.Heartbeat
+	if vp, ok := ref.Providers[name]; ok {
+		pss.SetUrls(vp.Urls)
+		pss.SetVersionGroup(vp.Version, vp.Group)
+		codecName = utils.If(vp.Codec != "", vp.Codec, codecName).(string)
+		protocol = utils.If(vp.Protocol != "", vp.Protocol, protocol).(string)
+		heartbeat = utils.If(vp.Heartbeat != 0, vp.Heartbeat, heartbeat).(int)
+	}
+	pss.SetCodec(codecName)
+	pss.SetProtocol(protocol, heartbeat)
+	pss.SetConnMetadata(c.connMeta)
+	ctx, cancel := context.WithCancel(c.ctx)
+	pss.Ctx = ctx
+	pss.Cancel = cancel
+	c.providers[name] = pss
+
+	if c.watching {
+		go pss.StartWatcher()
+	}
+	return pss
+}
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	rpcErrorType = reflect.TypeOf(RpcError{})
+	futureType   = reflect.TypeOf((*Future)(nil))
+)
+
+// stubType 消费方法字段的签名信息
+// 支持的签名：
+// func(Req) (Resp, error)
+// func(Req) (Resp, RpcError)
+// func(context.Context, Req) (Resp, error)
+// func(Req, *Resp) *Future
+// func(context.Context, Req, *Resp) *Future
+// Req与Resp为结构体或指向结构体的指针，如protobuf生成的消息类型*pb.HelloRequest
+type stubType struct {
+	replyType reflect.Type
+	// replyPtr 同步调用的返回值为指向结构体的指针
+	replyPtr bool
+	// withCtx 第一个入参为context.Context
+	withCtx bool
+	// async 异步调用，返回值写入最后一个入参，通过Future等待结果
+	async bool
+	// rpcError 第二个返回值为RpcError，调用成功时返回Err为nil的RpcError
+	rpcError bool
+}
+
+// argsIndex 请求参数在入参中的位置
+func (st *stubType) argsIndex() int {
+	idx := 0
+	if st.withCtx {
+		idx++
+	}
+	return idx
+}
+
+// results 根据调用结果生成返回值，reply为nil时返回零值
+// 异步调用仅用于在发起调用前出错时，返回已完成的Future
+func (st *stubType) results(reply interface{}, err error) []reflect.Value {
+	if st.async {
+		return []reflect.Value{reflect.ValueOf(newFuture().complete(err))}
+	}
+
+	resType := st.replyType
+	if st.replyPtr {
+		resType = reflect.PtrTo(st.replyType)
+	}
+	res := reflect.Zero(resType)
+	if reply != nil && err == nil {
+		res = reflect.ValueOf(reply)
+		if !st.replyPtr {
+			res = res.Elem()
+		}
+	}
+
+	if st.rpcError {
+		return []reflect.Value{res, reflect.ValueOf(RpcError{Err: err})}
+	}
+
+	errV := reflect.Zero(errorType)
+	if err != nil {
+		errV = reflect.ValueOf(&err).Elem()
+	}
+	return []reflect.Value{res, errV}
+}
+
+func checkMethodField(field *reflect.Value) (*stubType, error) {
 	if field.Kind() != reflect.Func {
 		return nil, errors.New("not a func field")
 	}
 
 	ft := field.Type()
+	if ft.NumOut() == 1 && ft.Out(0) == futureType {
+		return checkAsyncMethodField(ft)
+	}
 
-	if ft.NumIn() != 1 {
-		return nil, errors.New("number of input params must be only one")
+	st := &stubType{}
+
+	switch ft.NumIn() {
+	case 1:
+	case 2:
+		if ft.In(0) != contextType {
+			return nil, errors.New("first input param should be context.Context")
+		}
+		st.withCtx = true
+	default:
+		return nil, errors.New("number of input params must be one, or two with context.Context first")
 	}
 
 	if ft.NumOut() != 2 {
 		return nil, errors.New("number of output params must be only two")
 	}
 
-	iTyp := ft.In(0)
-	if iTyp.Kind() != reflect.Struct {
-		return nil, errors.New("input params type should be a struct")
+	if !isStructOrPtr(ft.In(st.argsIndex())) {
+		return nil, errors.New("input params type should be a struct or a pointer to struct")
 	}
 
 	rTyp := ft.Out(0)
-	if rTyp.Kind() != reflect.Struct {
-		return nil, errors.New("output params type should be a struct")
+	if !isStructOrPtr(rTyp) {
+		return nil, errors.New("output params type should be a struct or a pointer to struct")
+	}
+	if rTyp.Kind() == reflect.Ptr {
+		rTyp = rTyp.Elem()
+		st.replyPtr = true
+	}
+	st.replyType = rTyp
+
+	switch rErr := ft.Out(1); {
+	case rErr == errorType:
+	case rErr == rpcErrorType && !st.withCtx:
+		st.rpcError = true
+	default:
+		return nil, errors.New("invalid error param: should be error")
+	}
+
+	return st, nil
+}
+
+// checkAsyncMethodField 检查异步调用的签名：func([context.Context,] Req, *Resp) *Future
+func checkAsyncMethodField(ft reflect.Type) (*stubType, error) {
+	st := &stubType{async: true}
+
+	switch ft.NumIn() {
+	case 2:
+	case 3:
+		if ft.In(0) != contextType {
+			return nil, errors.New("first input param should be context.Context")
+		}
+		st.withCtx = true
+	default:
+		return nil, errors.New("number of input params must be two, or three with context.Context first")
+	}
+
+	if !isStructOrPtr(ft.In(st.argsIndex())) {
+		return nil, errors.New("input params type should be a struct or a pointer to struct")
 	}
 
-	rErr := ft.Out(1)
-	if rErr.Kind() != reflect.Struct {
-		return nil, errors.New("invalid error param")
+	rTyp := ft.In(ft.NumIn() - 1)
+	if rTyp.Kind() != reflect.Ptr || rTyp.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("reply param type should be a pointer to struct")
 	}
+	st.replyType = rTyp.Elem()
 
-	return &rTyp, nil
+	return st, nil
+}
+
+func isStructOrPtr(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
 }
@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+)
+
+// Fallback 降级处理函数，调用最终失败（含超时、熔断）时被调用，mock为force时代替调用
+// serviceMethod格式为provider.method，err为调用的错误，mock为force时为nil
+// 返回值reply可以是Resp或*Resp，为nil时返回零值；返回的错误不为nil时作为调用的错误
+type Fallback func(ctx context.Context, serviceMethod string, args interface{}, err error) (reply interface{}, fbErr error)
+
+// RegisterFallback 注册降级处理函数，methodName为空时对提供者的所有方法生效
+// 方法的降级处理函数优先于提供者的
+func (c *RpcConsumer) RegisterFallback(providerName, methodName string, fb Fallback) {
+	c.fbMu.Lock()
+	defer c.fbMu.Unlock()
+	c.fallbacks[fallbackKey(providerName, methodName)] = fb
+}
+
+func (c *RpcConsumer) fallback(providerName, methodName string) Fallback {
+	c.fbMu.RLock()
+	defer c.fbMu.RUnlock()
+	if fb, ok := c.fallbacks[fallbackKey(providerName, methodName)]; ok {
+		return fb
+	}
+	return c.fallbacks[fallbackKey(providerName, "")]
+}
+
+func fallbackKey(providerName, methodName string) string {
+	return providerName + "." + methodName
+}
+
+// invokeWithFallback 按mock配置调用降级处理函数，或在调用失败时降级
+func (c *RpcConsumer) invokeWithFallback(ctx context.Context, inv *rpcInvocation) (interface{}, error) {
+	fb := c.fallback(inv.info.ProviderName, inv.info.MethodName)
+
+	if inv.info.Mock == constants.MockForce {
+		if fb == nil {
+			return nil, fmt.Errorf("mock is forced but no fallback registered for %s", inv.serviceMethod)
+		}
+		return callFallback(ctx, fb, inv, nil)
+	}
+
+	res, err := doInvoke(ctx, inv)
+	if err != nil && fb != nil {
+		return callFallback(ctx, fb, inv, err)
+	}
+	return res, err
+}
+
+// callFallback 调用降级处理函数，将返回值转换为指向结果的指针
+func callFallback(ctx context.Context, fb Fallback, inv *rpcInvocation, err error) (interface{}, error) {
+	reply, fbErr := fb(ctx, inv.serviceMethod, inv.args, err)
+	if fbErr != nil {
+		return nil, fbErr
+	}
+	if reply == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(reply)
+	switch rv.Type() {
+	case reflect.PtrTo(inv.replyType):
+		return reply, nil
+	case inv.replyType:
+		ptr := reflect.New(inv.replyType)
+		ptr.Elem().Set(rv)
+		return ptr.Interface(), nil
+	default:
+		return nil, fmt.Errorf("fallback of %s returns %s, want %s", inv.serviceMethod, rv.Type(), inv.replyType)
+	}
+}
@@ -0,0 +1,201 @@
+package consumer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/codec"
+	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/metadata"
+	"github.com/ForeverSRC/morax/protocol"
+)
+
+// FramedClientCodec 帧协议的客户端编解码器
+// 定时发送心跳，超过3个心跳间隔未收到任何帧时关闭链接，链接上进行中的调用返回错误
+type FramedClientCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	cd   codec.Codec
+
+	wmu sync.Mutex // protects w, 请求与心跳可能并发写出
+	w   *bufio.Writer
+
+	// frame 当前读取的响应帧
+	frame *protocol.Frame
+	resp  codec.ResponseHeader
+
+	mutex sync.Mutex // protects calls
+	// calls 请求id->携带调用信息的入参，用于回填响应元数据与结构化错误
+	calls map[uint64]*callArgs
+
+	// lastRead 最近一次收到帧的时间，unix纳秒
+	lastRead  int64
+	heartbeat time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFramedClientCodec 请求体使用cd编码，heartbeat为0时不发送心跳
+func NewFramedClientCodec(conn io.ReadWriteCloser, cd codec.Codec, heartbeat time.Duration) *FramedClientCodec {
+	c := &FramedClientCodec{
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		cd:        cd,
+		w:         bufio.NewWriter(conn),
+		calls:     make(map[uint64]*callArgs),
+		lastRead:  time.Now().UnixNano(),
+		heartbeat: heartbeat,
+		done:      make(chan struct{}),
+	}
+	if heartbeat > 0 {
+		go c.keepalive()
+	}
+	return c
+}
+
+// SendMetadata 发送链接级别的元数据，提供者将其合并到此后每个请求的元数据中
+func (c *FramedClientCodec) SendMetadata(md metadata.MD) error {
+	return c.writeFrame(&protocol.Frame{Type: protocol.TypeMetadata, Meta: codec.MarshalMetadata(md)})
+}
+
+func (c *FramedClientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	h := codec.RequestHeader{ServiceMethod: r.ServiceMethod}
+	body := param
+	ca, isCall := param.(*callArgs)
+	if isCall {
+		body = ca.args
+		if !ca.deadline.IsZero() {
+			h.Timeout = remainingMillis(ca.deadline)
+		}
+		h.Meta = ca.md
+	}
+
+	b, err := codec.Marshal(c.cd, body)
+	if err != nil {
+		return err
+	}
+
+	if isCall {
+		c.mutex.Lock()
+		c.calls[r.Seq] = ca
+		c.mutex.Unlock()
+	}
+	err = c.writeFrame(&protocol.Frame{
+		Type:      protocol.TypeRequest,
+		CodecID:   c.cd.ID(),
+		RequestID: r.Seq,
+		Meta:      h.Marshal(),
+		Body:      b,
+	})
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.calls, r.Seq)
+		c.mutex.Unlock()
+	}
+	return err
+}
+
+// ReadResponseHeader 读取下一个响应帧，心跳与元数据帧在此处理
+func (c *FramedClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	for {
+		f, err := protocol.ReadFrame(c.r)
+		if err != nil {
+			return err
+		}
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+
+		switch f.Type {
+		case protocol.TypePing:
+			if err = c.writeFrame(&protocol.Frame{Type: protocol.TypePong, RequestID: f.RequestID}); err != nil {
+				return err
+			}
+		case protocol.TypePong, protocol.TypeMetadata:
+		case protocol.TypeResponse:
+			return c.readResponse(f, r)
+		default:
+			return fmt.Errorf("protocol: unexpected frame type %d", f.Type)
+		}
+	}
+}
+
+func (c *FramedClientCodec) readResponse(f *protocol.Frame, r *rpc.Response) error {
+	if err := c.resp.Unmarshal(f.Meta); err != nil {
+		return err
+	}
+	c.frame = f
+	r.Seq = f.RequestID
+	r.Error = c.resp.Error
+
+	c.mutex.Lock()
+	ca, ok := c.calls[r.Seq]
+	delete(c.calls, r.Seq)
+	c.mutex.Unlock()
+
+	if ok {
+		if ca.resp != nil && len(c.resp.Meta) > 0 {
+			ca.resp.Set(c.resp.Meta)
+		}
+		ca.remoteErr = c.resp.Status
+	}
+	return nil
+}
+
+// ReadResponseBody 响应体已随响应帧读出，x为nil时丢弃
+func (c *FramedClientCodec) ReadResponseBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	cd, err := codec.GetCodecByID(c.frame.CodecID)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(cd, c.frame.Body, x)
+}
+
+func (c *FramedClientCodec) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.conn.Close()
+}
+
+// keepalive 定时发送心跳，超过3个心跳间隔未收到任何帧时关闭链接
+func (c *FramedClientCodec) keepalive() {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+	var id uint64
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRead))) > 3*c.heartbeat {
+			logger.Error("rpc: heartbeat timeout, close connection")
+			_ = c.Close()
+			return
+		}
+		id++
+		if err := c.writeFrame(&protocol.Frame{Type: protocol.TypePing, RequestID: id}); err != nil {
+			_ = c.Close()
+			return
+		}
+	}
+}
+
+func (c *FramedClientCodec) writeFrame(f *protocol.Frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := protocol.WriteFrame(c.w, f); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
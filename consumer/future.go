@@ -0,0 +1,30 @@
+package consumer
+
+// Future 一次异步调用的结果
+// 调用完成后，返回值已写入调用时传入的reply指针，Done返回的channel被关闭
+type Future struct {
+	done chan struct{}
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// complete 设置调用结果，只能调用一次
+func (f *Future) complete(err error) *Future {
+	f.err = err
+	close(f.done)
+	return f
+}
+
+// Done 调用完成时关闭，可用于select同时等待多个调用
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 阻塞直至调用完成，返回调用的错误
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
@@ -0,0 +1,125 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+import (
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// Invoke 泛化调用，不需要预先声明消费结构体
+// args为任意可编码的参数，如结构体、map[string]interface{}、json.RawMessage；reply为接收返回值的非nil指针
+// 调用同样经过服务发现、负载均衡、超时与集群容错，未订阅的提供者在首次调用时订阅
+// 需在consumer开始监听提供者（服务启动）后调用，否则返回ErrNotWatching
+func (c *RpcConsumer) Invoke(ctx context.Context, providerName, methodName string, args interface{}, reply interface{}) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			logger.Error("recover: rpc call panic:%v", e)
+			err = fmt.Errorf("rpc call panic: %v", e)
+		}
+	}()
+
+	// consumer处于shutdown阶段时停止一切调用，返回错误
+	if c.inShutdown.IsSet() {
+		return merr.ErrShutdown
+	}
+
+	rv := reflect.ValueOf(reply)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("reply must be a non-nil pointer")
+	}
+
+	if ctx == nil {
+		ctx = c.ctx
+	}
+
+	gm, err := c.genericMethod(providerName, methodName)
+	if err != nil {
+		return err
+	}
+
+	// 首次订阅时等待实例同步，最多等待一次调用的超时时间，同步完成后立即返回
+	waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(gm.info.Timeout))
+	_ = gm.pss.WaitReady(waitCtx)
+	cancel()
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	inv := &rpcInvocation{
+		info:          gm.info,
+		serviceMethod: gm.serviceMethod,
+		ps:            gm.pss,
+		args:          args,
+		replyType:     rv.Type().Elem(),
+		retryQueue:    c.retryQueue,
+	}
+
+	// 容错策略忽略错误时res为nil，reply保持不变
+	res, err := c.invoke(ctx, inv)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		rv.Elem().Set(reflect.ValueOf(res).Elem())
+	}
+	return nil
+}
+
+// genericMethod 泛化调用的方法，配置与订阅的提供者在首次调用时解析
+type genericMethod struct {
+	info          *MethodInfo
+	serviceMethod string
+	pss           *ProviderInstances
+}
+
+// genericMethod 返回泛化调用的方法，按provider.method缓存
+// consumer未开始监听提供者时返回ErrNotWatching，避免每次调用都等待到超时
+func (c *RpcConsumer) genericMethod(providerName, methodName string) (*genericMethod, error) {
+	c.mu.Lock()
+	watching := c.watching
+	c.mu.Unlock()
+	if !watching {
+		return nil, merr.ErrNotWatching
+	}
+
+	key := fmt.Sprintf("%s.%s", providerName, methodName)
+	c.gmMu.RLock()
+	gm, ok := c.generics[key]
+	c.gmMu.RUnlock()
+	if ok {
+		return gm, nil
+	}
+
+	c.gmMu.Lock()
+	defer c.gmMu.Unlock()
+	if gm, ok = c.generics[key]; ok {
+		return gm, nil
+	}
+	info := &MethodInfo{
+		ProviderName: providerName,
+		MethodName:   methodName,
+	}
+	info.SetConfigInfo(c.conf)
+	gm = &genericMethod{
+		info:          info,
+		serviceMethod: key,
+		pss:           c.subscribe(providerName),
+	}
+	c.generics[key] = gm
+	return gm, nil
+}
+
+// InvokeRaw 以JSON格式的参数进行泛化调用，返回JSON格式的结果
+func (c *RpcConsumer) InvokeRaw(ctx context.Context, providerName, methodName string, args json.RawMessage) (json.RawMessage, error) {
+	var reply json.RawMessage
+	err := c.Invoke(ctx, providerName, methodName, args, &reply)
+	return reply, err
+}
@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+// Call 一次消费方法调用的信息，在拦截器链中传递
+type Call struct {
+	// ProviderName MethodName 调用的提供者服务名与方法名
+	ProviderName string
+	MethodName   string
+	// Args 调用的参数，拦截器可在调用前替换
+	Args interface{}
+	// Metadata 请求元数据，初始为调用方context中的元数据，拦截器可在调用前修改
+	Metadata metadata.MD
+	// ResponseMetadata 提供者返回的响应元数据，调用完成后设置
+	ResponseMetadata metadata.MD
+	// Reply 指向调用结果的指针，调用完成后设置，失败或无结果时为nil
+	Reply interface{}
+	// Latency 负载均衡与调用（含重试、降级）的耗时，调用完成后设置
+	Latency time.Duration
+}
+
+// Invoker 执行调用，返回调用的错误
+type Invoker func(ctx context.Context, call *Call) error
+
+// Interceptor 消费方法调用的拦截器
+// 拦截器通过调用next继续执行调用，不调用next时调用被拦截，返回的错误作为调用的错误
+type Interceptor interface {
+	Intercept(ctx context.Context, call *Call, next Invoker) error
+}
+
+// InterceptorFunc 函数形式的拦截器
+type InterceptorFunc func(ctx context.Context, call *Call, next Invoker) error
+
+func (f InterceptorFunc) Intercept(ctx context.Context, call *Call, next Invoker) error {
+	return f(ctx, call, next)
+}
+
+// AddInterceptor 添加对所有提供者生效的拦截器
+func (c *RpcConsumer) AddInterceptor(i Interceptor) {
+	c.icMu.Lock()
+	defer c.icMu.Unlock()
+	c.interceptors = append(c.interceptors, i)
+}
+
+// AddProviderInterceptor 添加对指定提供者生效的拦截器
+func (c *RpcConsumer) AddProviderInterceptor(providerName string, i Interceptor) {
+	c.icMu.Lock()
+	defer c.icMu.Unlock()
+	c.providerInterceptors[providerName] = append(c.providerInterceptors[providerName], i)
+}
+
+// chain 返回提供者的拦截器链，全局拦截器在前，同一级别按添加顺序执行
+func (c *RpcConsumer) chain(providerName string) []Interceptor {
+	c.icMu.RLock()
+	defer c.icMu.RUnlock()
+	res := make([]Interceptor, 0, len(c.interceptors)+len(c.providerInterceptors[providerName]))
+	res = append(res, c.interceptors...)
+	return append(res, c.providerInterceptors[providerName]...)
+}
+
+// invoke 经过拦截器链后，进行负载均衡与调用
+func (c *RpcConsumer) invoke(ctx context.Context, inv *rpcInvocation) (interface{}, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	call := &Call{
+		ProviderName: inv.info.ProviderName,
+		MethodName:   inv.info.MethodName,
+		Args:         inv.args,
+		Metadata:     md.Copy(),
+	}
+
+	next := func(ctx context.Context, call *Call) error {
+		start := time.Now()
+		inv.args = call.Args
+		callerResp, hasResp := metadata.ResponseFromContext(ctx)
+		ctx, resp := metadata.NewResponseContext(metadata.NewOutgoingContext(ctx, call.Metadata))
+
+		res, err := c.invokeWithFallback(ctx, inv)
+		call.Reply = res
+		call.Latency = time.Since(start)
+		call.ResponseMetadata = resp.MD()
+		if hasResp {
+			callerResp.Set(call.ResponseMetadata)
+		}
+		return err
+	}
+
+	interceptors := c.chain(inv.info.ProviderName)
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, n := interceptors[i], next
+		next = func(ctx context.Context, call *Call) error {
+			return ic.Intercept(ctx, call, n)
+		}
+	}
+
+	err := next(ctx, call)
+	return call.Reply, err
+}
@@ -0,0 +1,232 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/breaker"
+	"github.com/ForeverSRC/morax/cluster"
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/common/utils"
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/loadbalance"
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+// rpcInvocation 消费方法的一次调用，实现cluster.Invocation
+type rpcInvocation struct {
+	info          *MethodInfo
+	serviceMethod string
+	ps            *ProviderInstances
+	args          interface{}
+	replyType     reflect.Type
+	retryQueue    *cluster.RetryQueue
+	// target 异步调用中调用方传入的reply，响应直接解码到该指针，为nil时每次调用新建返回值
+	target *replyTarget
+}
+
+// replyTarget 调用方传入的reply指针，同一次调用的多次尝试（重试、forking、broadcast）共用
+// 只有第一个成功解码的响应写入，调用结束后关闭，此后到达的响应（如超时的尝试、failback的后台重试）不再写入
+type replyTarget struct {
+	ptr     reflect.Value
+	mu      sync.Mutex
+	written bool
+	closed  bool
+}
+
+// read 由编解码器调用，将响应体解码到reply指针，已写入或已关闭时丢弃响应体
+func (t *replyTarget) read(cd rpc.ClientCodec) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.written || t.closed {
+		return cd.ReadResponseBody(nil)
+	}
+	if err := cd.ReadResponseBody(t.ptr.Interface()); err != nil {
+		return err
+	}
+	t.written = true
+	return nil
+}
+
+// close 调用结束，等待进行中的解码完成
+func (t *replyTarget) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+}
+
+func (inv *rpcInvocation) ServiceMethod() string {
+	return inv.serviceMethod
+}
+
+func (inv *rpcInvocation) Retries() int {
+	return inv.info.Retries
+}
+
+func (inv *rpcInvocation) Backoff(retry int) time.Duration {
+	return utils.BackoffDelay(inv.info.Backoff,
+		time.Millisecond*time.Duration(inv.info.BackoffDelay),
+		time.Millisecond*time.Duration(inv.info.BackoffMaxDelay),
+		retry)
+}
+
+// Retryable 按错误类型或提供者返回的错误码判断是否在配置的可重试范围内
+func (inv *rpcInvocation) Retryable(err error) bool {
+	kind := errorKind(err)
+	code := ""
+	if kind == constants.RetryOnRemote {
+		code = string(merr.CodeOf(err))
+	}
+
+	for _, r := range inv.info.RetryOn {
+		if r == kind || r == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (inv *rpcInvocation) RetryQueue() *cluster.RetryQueue {
+	return inv.retryQueue
+}
+
+func (inv *rpcInvocation) Forks() int {
+	return inv.info.Forks
+}
+
+// Select 熔断的实例不参与负载均衡
+func (inv *rpcInvocation) Select(lbInv *loadbalance.Invocation) (string, error) {
+	return inv.ps.LoadBalance(inv.info.LBType, lbInv, inv.ready())
+}
+
+func (inv *rpcInvocation) Instances() []string {
+	return inv.ps.InstanceIds(inv.ready())
+}
+
+// methodBreaker 返回方法级熔断器，未启用方法级熔断时返回nil
+func (inv *rpcInvocation) methodBreaker() *breaker.Breaker {
+	conf := inv.info.BreakerConfig()
+	if conf == nil || inv.info.BreakerLevel != constants.BreakerLevelMethod {
+		return nil
+	}
+	return inv.ps.Breaker(inv.info.MethodName, "", conf)
+}
+
+// instanceBreaker 返回实例的熔断器，未启用实例级熔断时返回nil
+func (inv *rpcInvocation) instanceBreaker(id string) *breaker.Breaker {
+	conf := inv.info.BreakerConfig()
+	if conf == nil || inv.info.BreakerLevel != constants.BreakerLevelInstance {
+		return nil
+	}
+	return inv.ps.Breaker(inv.info.MethodName, id, conf)
+}
+
+// ready 负载均衡时过滤熔断的实例，未启用实例级熔断时返回nil
+func (inv *rpcInvocation) ready() func(id string) bool {
+	if inv.info.BreakerConfig() == nil || inv.info.BreakerLevel != constants.BreakerLevelInstance {
+		return nil
+	}
+	return func(id string) bool {
+		return inv.instanceBreaker(id).Ready()
+	}
+}
+
+// Invoke 对指定实例进行一次调用，超时或ctx取消时立即返回
+// 启用实例级熔断时，熔断的实例直接返回breaker.ErrOpen，调用结果计入熔断统计
+func (inv *rpcInvocation) Invoke(ctx context.Context, id string) (res interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if b := inv.instanceBreaker(id); b != nil {
+		if !b.Allow() {
+			return nil, breaker.ErrOpen
+		}
+		defer func() {
+			recordBreaker(ctx, b, err)
+		}()
+	}
+
+	return inv.invoke(ctx, id)
+}
+
+func (inv *rpcInvocation) invoke(ctx context.Context, id string) (interface{}, error) {
+	client, err := inv.ps.Client(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 调用方的context带有deadline时以其为准，否则使用配置的超时时间，随请求传递给提供者
+	callCtx, cancel := ctx, context.CancelFunc(func() {})
+	if _, ok := ctx.Deadline(); !ok {
+		callCtx, cancel = context.WithTimeout(ctx, time.Millisecond*time.Duration(inv.info.Timeout))
+	}
+	defer cancel()
+	deadline, _ := callCtx.Deadline()
+
+	// reply为指向返回值的指针，异步调用中为replyTarget，由编解码器解码到调用方传入的指针
+	var reply, res interface{}
+	if inv.target != nil {
+		reply, res = inv.target, inv.target.ptr.Interface()
+	} else {
+		res = reflect.New(inv.replyType).Interface()
+		reply = res
+	}
+	args := &callArgs{args: inv.args, deadline: deadline}
+	args.md, _ = metadata.FromOutgoingContext(ctx)
+	args.resp, _ = metadata.ResponseFromContext(ctx)
+	call := client.Go(inv.serviceMethod, args, reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			// 提供者返回结构化错误时返回该错误，保留错误码
+			if args.remoteErr != nil {
+				return nil, args.remoteErr
+			}
+			return nil, call.Error
+		}
+		return res, nil
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, merr.ErrTimeout
+	}
+}
+
+// recordBreaker 记录调用结果，调用方取消的请求不计入统计
+// 提供者返回的错误说明实例可用，不计为失败，错误码为unavailable、timeout的除外
+func recordBreaker(ctx context.Context, b *breaker.Breaker, err error) {
+	if err != nil && ctx.Err() != nil {
+		b.Release()
+		return
+	}
+
+	success := err == nil
+	if !success && errorKind(err) == constants.RetryOnRemote {
+		code := merr.CodeOf(err)
+		success = code != merr.CodeUnavailable && code != merr.CodeTimeout
+	}
+	b.Record(success)
+}
+
+// errorKind 错误分类：提供者返回的错误、超时，其余均视为链接错误
+func errorKind(err error) string {
+	var se rpc.ServerError
+	var re *merr.Error
+	switch {
+	case errors.As(err, &re), errors.As(err, &se):
+		return constants.RetryOnRemote
+	case errors.Is(err, merr.ErrTimeout):
+		return constants.RetryOnTimeout
+	default:
+		return constants.RetryOnConnection
+	}
+}
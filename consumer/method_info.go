@@ -2,9 +2,11 @@ package consumer
 
 import (
 	"strings"
+	"time"
 )
 
 import (
+	"github.com/ForeverSRC/morax/breaker"
 	"github.com/ForeverSRC/morax/common/constants"
 	"github.com/ForeverSRC/morax/common/utils"
 	cc "github.com/ForeverSRC/morax/config/consumer"
@@ -14,27 +16,98 @@ type MethodInfo struct {
 	ProviderName string
 	MethodName   string
 	cc.ConfInfo
+	// breakerConf 熔断器配置，未启用熔断时为nil
+	breakerConf *breaker.Config
 }
 
 func (mi *MethodInfo) SetConfigInfo(c *cc.ConsumerConfig) {
 	mi.LBType = c.Reference.LBType
 	mi.Timeout = c.Reference.Timeout
 	mi.Retries = c.Reference.Retries
+	mi.Cluster = c.Reference.Cluster
+	mi.Forks = c.Reference.Forks
+	mi.Backoff = c.Reference.Backoff
+	mi.BackoffDelay = c.Reference.BackoffDelay
+	mi.BackoffMaxDelay = c.Reference.BackoffMaxDelay
+	mi.RetryOn = c.Reference.RetryOn
+	mi.BreakerFailures = c.Reference.BreakerFailures
+	mi.BreakerErrorRate = c.Reference.BreakerErrorRate
+	mi.BreakerMinRequests = c.Reference.BreakerMinRequests
+	mi.BreakerWindow = c.Reference.BreakerWindow
+	mi.BreakerCooldown = c.Reference.BreakerCooldown
+	mi.BreakerLevel = c.Reference.BreakerLevel
+	mi.Mock = c.Reference.Mock
 
 	vp, ok := c.Reference.Providers[mi.ProviderName]
 	if ok {
 		mi.LBType = utils.If(vp.LBType != "", vp.LBType, mi.LBType).(string)
 		mi.Timeout = utils.If(vp.Timeout != 0, vp.Timeout, mi.Timeout).(int)
 		mi.Retries = utils.If(vp.Retries != 0, vp.Retries, mi.Retries).(int)
+		mi.Cluster = utils.If(vp.Cluster != "", vp.Cluster, mi.Cluster).(string)
+		mi.Forks = utils.If(vp.Forks != 0, vp.Forks, mi.Forks).(int)
+		mi.Backoff = utils.If(vp.Backoff != "", vp.Backoff, mi.Backoff).(string)
+		mi.BackoffDelay = utils.If(vp.BackoffDelay != 0, vp.BackoffDelay, mi.BackoffDelay).(int)
+		mi.BackoffMaxDelay = utils.If(vp.BackoffMaxDelay != 0, vp.BackoffMaxDelay, mi.BackoffMaxDelay).(int)
+		mi.RetryOn = utils.If(len(vp.RetryOn) != 0, vp.RetryOn, mi.RetryOn).([]string)
+		mi.BreakerFailures = utils.If(vp.BreakerFailures != 0, vp.BreakerFailures, mi.BreakerFailures).(int)
+		mi.BreakerErrorRate = utils.If(vp.BreakerErrorRate != 0, vp.BreakerErrorRate, mi.BreakerErrorRate).(int)
+		mi.BreakerMinRequests = utils.If(vp.BreakerMinRequests != 0, vp.BreakerMinRequests, mi.BreakerMinRequests).(int)
+		mi.BreakerWindow = utils.If(vp.BreakerWindow != 0, vp.BreakerWindow, mi.BreakerWindow).(int)
+		mi.BreakerCooldown = utils.If(vp.BreakerCooldown != 0, vp.BreakerCooldown, mi.BreakerCooldown).(int)
+		mi.BreakerLevel = utils.If(vp.BreakerLevel != "", vp.BreakerLevel, mi.BreakerLevel).(string)
+		mi.Mock = utils.If(vp.Mock != "", vp.Mock, mi.Mock).(string)
 
 		vm, ok := vp.Methods[strings.ToLower(mi.MethodName)]
 		if ok {
 			mi.LBType = utils.If(vm.LBType != "", vm.LBType, mi.LBType).(string)
 			mi.Timeout = utils.If(vm.Timeout != 0, vm.Timeout, mi.Timeout).(int)
 			mi.Retries = utils.If(vm.Retries != 0, vm.Retries, mi.Retries).(int)
+			mi.Cluster = utils.If(vm.Cluster != "", vm.Cluster, mi.Cluster).(string)
+			mi.Forks = utils.If(vm.Forks != 0, vm.Forks, mi.Forks).(int)
+			mi.Backoff = utils.If(vm.Backoff != "", vm.Backoff, mi.Backoff).(string)
+			mi.BackoffDelay = utils.If(vm.BackoffDelay != 0, vm.BackoffDelay, mi.BackoffDelay).(int)
+			mi.BackoffMaxDelay = utils.If(vm.BackoffMaxDelay != 0, vm.BackoffMaxDelay, mi.BackoffMaxDelay).(int)
+			mi.RetryOn = utils.If(len(vm.RetryOn) != 0, vm.RetryOn, mi.RetryOn).([]string)
+			mi.BreakerFailures = utils.If(vm.BreakerFailures != 0, vm.BreakerFailures, mi.BreakerFailures).(int)
+			mi.BreakerErrorRate = utils.If(vm.BreakerErrorRate != 0, vm.BreakerErrorRate, mi.BreakerErrorRate).(int)
+			mi.BreakerMinRequests = utils.If(vm.BreakerMinRequests != 0, vm.BreakerMinRequests, mi.BreakerMinRequests).(int)
+			mi.BreakerWindow = utils.If(vm.BreakerWindow != 0, vm.BreakerWindow, mi.BreakerWindow).(int)
+			mi.BreakerCooldown = utils.If(vm.BreakerCooldown != 0, vm.BreakerCooldown, mi.BreakerCooldown).(int)
+			mi.BreakerLevel = utils.If(vm.BreakerLevel != "", vm.BreakerLevel, mi.BreakerLevel).(string)
+			mi.Mock = utils.If(vm.Mock != "", vm.Mock, mi.Mock).(string)
 		}
 	}
 
 	mi.LBType = utils.If(mi.LBType == "", constants.DefaultLoadBalance, mi.LBType).(string)
 	mi.Timeout = utils.If(mi.Timeout == 0, constants.DefaultTimeOut, mi.Timeout).(int)
+	mi.Cluster = utils.If(mi.Cluster == "", constants.DefaultCluster, mi.Cluster).(string)
+	mi.Forks = utils.If(mi.Forks == 0, constants.DefaultForks, mi.Forks).(int)
+	mi.Backoff = utils.If(mi.Backoff == "", constants.NoBackoff, mi.Backoff).(string)
+	// 未配置时只重试链接错误与超时，提供者返回的错误需显式配置remote或错误码
+	mi.RetryOn = utils.If(mi.RetryOn == nil, []string{constants.RetryOnConnection, constants.RetryOnTimeout}, mi.RetryOn).([]string)
+	mi.BreakerMinRequests = utils.If(mi.BreakerMinRequests == 0, constants.DefaultBreakerMinRequests, mi.BreakerMinRequests).(int)
+	mi.BreakerWindow = utils.If(mi.BreakerWindow == 0, constants.DefaultBreakerWindow, mi.BreakerWindow).(int)
+	mi.BreakerCooldown = utils.If(mi.BreakerCooldown == 0, constants.DefaultBreakerCooldown, mi.BreakerCooldown).(int)
+	mi.BreakerLevel = utils.If(mi.BreakerLevel == "", constants.DefaultBreakerLevel, mi.BreakerLevel).(string)
+	mi.Mock = utils.If(mi.Mock == "", constants.DefaultMock, mi.Mock).(string)
+	mi.breakerConf = mi.newBreakerConfig()
+}
+
+// BreakerConfig 熔断器配置，未配置熔断条件时返回nil
+func (mi *MethodInfo) BreakerConfig() *breaker.Config {
+	return mi.breakerConf
+}
+
+func (mi *MethodInfo) newBreakerConfig() *breaker.Config {
+	conf := &breaker.Config{
+		Failures:    mi.BreakerFailures,
+		ErrorRate:   mi.BreakerErrorRate,
+		MinRequests: mi.BreakerMinRequests,
+		Window:      time.Millisecond * time.Duration(mi.BreakerWindow),
+		Cooldown:    time.Millisecond * time.Duration(mi.BreakerCooldown),
+	}
+	if !conf.Enabled() {
+		return nil
+	}
+	return conf
 }
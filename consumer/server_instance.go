@@ -3,22 +3,48 @@ package consumer
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/rpc"
-	"net/rpc/jsonrpc"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 import (
+	"github.com/ForeverSRC/morax/breaker"
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/common/utils"
+	merr "github.com/ForeverSRC/morax/error"
 	"github.com/ForeverSRC/morax/loadbalance"
 	"github.com/ForeverSRC/morax/logger"
-	"github.com/ForeverSRC/morax/registry/consul"
+	"github.com/ForeverSRC/morax/metadata"
+	"github.com/ForeverSRC/morax/registry"
 )
 
 type providerInstance struct {
 	id   string
 	host string
 	port int
+	// tags meta 注册中心中实例的标签与元数据，用于路由及负载均衡
+	tags   []string
+	meta   map[string]string
+	client *rpc.Client
+	// codec client使用的编解码器，记录链接是否已断开
+	codec *trackedCodec
+}
+
+// broken 链接已断开，client不再可用
+func (inst *providerInstance) broken() bool {
+	return inst.codec.broken.IsSet()
+}
+
+// close 关闭链接，rpc.Client已因读取出错停止时直接关闭编解码器
+func (inst *providerInstance) close() {
+	if err := inst.client.Close(); err == rpc.ErrShutdown {
+		_ = inst.codec.Close()
+	}
 }
 
 // ProviderInstances 提供者集群信息
@@ -27,43 +53,258 @@ type ProviderInstances struct {
 	Cancel context.CancelFunc
 	// providerName 订阅的服务名
 	providerName string
-	// instances provider实例map ID->rpc.Client
-	instances map[string]*rpc.Client
+	// reg 注册中心
+	reg registry.Registry
+	// urls 直连的提供者地址，不为空时不通过注册中心发现实例
+	urls []string
+	// version group 消费的提供者版本与分组
+	version string
+	group   string
+	// protocol codec 与提供者通信使用的协议与编解码器
+	protocol string
+	codec    string
+	// heartbeat 帧协议的心跳间隔
+	heartbeat time.Duration
+	// connMeta 帧协议中链接建立后发送的链接元数据
+	connMeta metadata.MD
+	// instances provider实例map ID->实例
+	instances map[string]*providerInstance
 	ids       []string
+	infos     map[string]*loadbalance.InstanceInfo // 实例的标签与元数据，随ids整体替换，负载均衡时只读共享
 	idx       uint64
 	mu        sync.RWMutex
+	// ready 首次同步实例（无论成功与否）后关闭
+	ready     chan struct{}
+	readyOnce sync.Once
+	// redial 有链接断开时通知重新建立链接
+	redial chan struct{}
+	// breakers 熔断器 方法名->实例ID->熔断器，实例ID为空时为方法级熔断器
+	breakers map[string]map[string]*breaker.Breaker
+	bmu      sync.Mutex
 }
 
-func NewProviderInstances(name string) *ProviderInstances {
+func NewProviderInstances(name string, reg registry.Registry) *ProviderInstances {
 	return &ProviderInstances{
 		providerName: name,
-		instances:    make(map[string]*rpc.Client),
+		reg:          reg,
+		instances:    make(map[string]*providerInstance),
+		ready:        make(chan struct{}),
+		redial:       make(chan struct{}, 1),
+		codec:        constants.DefaultCodec,
+		heartbeat:    time.Millisecond * constants.DefaultHeartbeat,
+		breakers:     make(map[string]map[string]*breaker.Breaker),
 	}
 }
 
-func (ps *ProviderInstances) LoadBalance(lbType string) (*rpc.Client, error) {
+// WaitReady 阻塞直至首次同步实例完成或ctx取消
+func (ps *ProviderInstances) WaitReady(ctx context.Context) error {
+	select {
+	case <-ps.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ps *ProviderInstances) setReady() {
+	ps.readyOnce.Do(func() {
+		close(ps.ready)
+	})
+}
+
+// LoadBalance 通过负载均衡选择实例，返回实例ID
+// 链接已断开的实例与inv中排除的实例不参与选择，ready不为nil时仅选择ready返回true的实例
+func (ps *ProviderInstances) LoadBalance(lbType string, inv *loadbalance.Invocation, ready func(id string) bool) (string, error) {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 	if ps.instances == nil {
-		return nil, fmt.Errorf("provider: %s zero instance", ps.providerName)
+		return "", fmt.Errorf("provider: %s zero instance: %w", ps.providerName, merr.ErrNoInstance)
 	}
-	inst, err := loadbalance.DoBalance(lbType, ps.ids)
-	if err != nil {
-		return nil, err
+
+	connected := ps.connectedIdsLocked()
+	ids := filterIds(connected, ready)
+	if len(ids) == 0 && len(connected) > 0 {
+		return "", breaker.ErrOpen
 	}
 
-	return ps.instances[inst], nil
+	// 在副本上填入实例信息，不修改调用方跨重试共用的inv
+	lbInv := loadbalance.Invocation{}
+	if inv != nil {
+		lbInv = *inv
+	}
+	lbInv.Instances = ps.infos
+	return loadbalance.DoBalance(lbType, &lbInv, ids)
 }
 
-func (ps *ProviderInstances) setLocked(key string, value *providerInstance) {
-	target := fmt.Sprintf("%s:%d", value.host, value.port)
-	client, err := jsonrpc.Dial("tcp", target)
-	if err != nil {
-		logger.Error("connect to %s error: %s", target, err)
+// InstanceIds 返回当前链接可用的实例ID的副本，ready不为nil时仅返回ready返回true的实例
+func (ps *ProviderInstances) InstanceIds(ready func(id string) bool) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	if ps.instances == nil {
+		return nil
+	}
+
+	return filterIds(ps.connectedIdsLocked(), ready)
+}
+
+// connectedIdsLocked 返回链接未断开的实例ID，断开的实例在重新建立链接后恢复
+func (ps *ProviderInstances) connectedIdsLocked() []string {
+	return filterIds(ps.ids, func(id string) bool {
+		return !ps.instances[id].broken()
+	})
+}
+
+// notifyBroken 链接断开时通知重新建立链接
+func (ps *ProviderInstances) notifyBroken() {
+	select {
+	case ps.redial <- struct{}{}:
+	default:
+	}
+}
+
+func filterIds(ids []string, ready func(id string) bool) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if ready == nil || ready(id) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// Breaker 返回方法在指定实例上的熔断器，id为空时返回方法级熔断器，不存在时按conf创建
+func (ps *ProviderInstances) Breaker(method, id string, conf *breaker.Config) *breaker.Breaker {
+	ps.bmu.Lock()
+	defer ps.bmu.Unlock()
+	bs, ok := ps.breakers[method]
+	if !ok {
+		bs = make(map[string]*breaker.Breaker)
+		ps.breakers[method] = bs
+	}
+
+	b, ok := bs[id]
+	if !ok {
+		b = breaker.New(*conf)
+		bs[id] = b
+	}
+	return b
+}
+
+// removeBreakers 移除已下线实例的熔断器
+func (ps *ProviderInstances) removeBreakers(id string) {
+	ps.bmu.Lock()
+	defer ps.bmu.Unlock()
+	for _, bs := range ps.breakers {
+		delete(bs, id)
+	}
+}
+
+// Client 返回指定实例的rpc client
+func (ps *ProviderInstances) Client(id string) (*rpc.Client, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	inst, ok := ps.instances[id]
+	if !ok {
+		return nil, fmt.Errorf("provider: %s instance %s not found", ps.providerName, id)
+	}
+
+	return inst.client, nil
+}
+
+// dialTask 待建立的链接，在持有锁时创建，不持有锁时建立链接，再持有锁换入实例
+type dialTask struct {
+	key    string
+	inst   *providerInstance
+	target string
+	opts   dialOptions
+	client *rpc.Client
+	codec  *trackedCodec
+}
+
+// dialTaskLocked 创建与实例建立链接的任务，key为实例在instances中的键
+func (ps *ProviderInstances) dialTaskLocked(key string, inst *providerInstance) *dialTask {
+	return &dialTask{
+		key:    key,
+		inst:   inst,
+		target: fmt.Sprintf("%s:%d", inst.host, inst.port),
+		opts:   ps.dialOptionsOf(inst),
+	}
+}
+
+// installLocked 换入建立的链接，新实例加入instances，已有实例替换已断开的链接
+// 建立链接期间监听已取消、实例已被移除或替换、链接已由其他任务恢复时关闭新链接
+func (ps *ProviderInstances) installLocked(t *dialTask) bool {
+	if t.client == nil {
+		return false
+	}
+
+	cur, ok := ps.instances[t.key]
+	var install bool
+	switch {
+	case ps.Ctx != nil && ps.Ctx.Err() != nil, ps.instances == nil:
+	case !ok:
+		// 新实例尚未建立过链接；已建立过链接的实例已被移除
+		install = t.inst.client == nil
+	default:
+		install = cur == t.inst && cur.broken()
+	}
+
+	if !install {
+		_ = t.client.Close()
+		return false
+	}
+
+	if t.inst.client != nil {
+		t.inst.close()
+	}
+	t.inst.client = t.client
+	t.inst.codec = t.codec
+	ps.instances[t.key] = t.inst
+	return true
+}
+
+// dialAndInstall 不持有锁并发地建立链接，每个链接建立后立即换入，单个实例最多阻塞DialTimeout，不影响其他实例
+// 调用时需持有写锁，返回时仍持有写锁；已取消监听时不再建立链接，避免关机后遗留链接
+func (ps *ProviderInstances) dialAndInstall(tasks []*dialTask) {
+	if len(tasks) == 0 {
 		return
 	}
 
-	ps.instances[key] = client
+	ps.mu.Unlock()
+	defer ps.mu.Lock()
+	wg := new(sync.WaitGroup)
+	for _, t := range tasks {
+		if ps.Ctx != nil && ps.Ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(t *dialTask) {
+			defer wg.Done()
+			client, codec, err := dial(t.target, t.opts)
+			if err != nil {
+				logger.Error("connect to %s error: %s", t.target, err)
+				return
+			}
+
+			t.client, t.codec = client, codec
+			ps.mu.Lock()
+			defer ps.mu.Unlock()
+			if ps.installLocked(t) {
+				ps.setInstancesIds()
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+// closeAll 关闭所有实例的链接
+func (ps *ProviderInstances) closeAll() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, inst := range ps.instances {
+		inst.close()
+	}
 }
 
 func (ps *ProviderInstances) setIndexLocked(idx uint64, setZero bool) {
@@ -77,23 +318,125 @@ func (ps *ProviderInstances) setIndexLocked(idx uint64, setZero bool) {
 func (ps *ProviderInstances) setInstancesIds() {
 	count := len(ps.instances)
 	ids := make([]string, count)
+	infos := make(map[string]*loadbalance.InstanceInfo, count)
 	i := 0
-	for k := range ps.instances {
+	for k, v := range ps.instances {
 		ids[i] = k
+		infos[k] = &loadbalance.InstanceInfo{ID: v.id, Tags: v.tags, Meta: v.meta}
+		i++
 	}
 
 	sort.Strings(ids)
 	ps.ids = ids
+	ps.infos = infos
+}
+
+// SetUrls 设置直连的提供者地址
+func (ps *ProviderInstances) SetUrls(urls []string) {
+	ps.urls = urls
+}
+
+// SetCodec 设置与提供者通信使用的编解码器，为空时使用json
+func (ps *ProviderInstances) SetCodec(name string) {
+	if name == "" {
+		name = constants.DefaultCodec
+	}
+	ps.codec = name
+}
+
+// SetProtocol 设置与提供者通信使用的协议，为空时根据实例声明的协议选择；heartbeat为帧协议的心跳间隔，单位毫秒
+func (ps *ProviderInstances) SetProtocol(protocol string, heartbeat int) {
+	ps.protocol = protocol
+	if heartbeat != 0 {
+		ps.heartbeat = time.Millisecond * time.Duration(heartbeat)
+	}
+}
+
+// SetConnMetadata 设置帧协议中链接建立后发送的链接元数据
+func (ps *ProviderInstances) SetConnMetadata(md metadata.MD) {
+	ps.connMeta = md
+}
+
+// dialOptionsOf 确定与实例通信使用的协议与编解码器
+// 实例在注册中心的元数据中声明了支持帧协议时，未配置协议或配置为帧协议则使用帧协议，否则使用流式协议
+// 实例不支持配置的编解码器时使用json；直连的实例没有元数据，使用配置的协议与编解码器，未配置协议时使用流式协议
+func (ps *ProviderInstances) dialOptionsOf(ins *providerInstance) dialOptions {
+	opts := dialOptions{
+		protocol:  ps.protocol,
+		codec:     ps.codec,
+		heartbeat: ps.heartbeat,
+		connMeta:  ps.connMeta,
+		onBroken:  ps.notifyBroken,
+	}
+	if ins.meta == nil {
+		opts.protocol = utils.If(opts.protocol != "", opts.protocol, constants.DefaultProtocol).(string)
+		return opts
+	}
+
+	if opts.protocol != constants.ProtocolStream {
+		opts.protocol = utils.If(advertised(ins.meta, constants.MetaProtocols, constants.ProtocolMorax),
+			constants.ProtocolMorax, constants.ProtocolStream).(string)
+	}
+	if opts.codec != constants.JsonCodec && !advertised(ins.meta, constants.MetaCodecs, opts.codec) {
+		logger.Warn("provider: %s instance %s does not support codec %s, use %s", ps.providerName, ins.id, opts.codec, constants.JsonCodec)
+		opts.codec = constants.JsonCodec
+	}
+	return opts
+}
+
+// advertised 实例元数据中以逗号分隔的列表是否包含name
+func advertised(meta map[string]string, key, name string) bool {
+	for _, v := range strings.Split(meta[key], ",") {
+		if strings.TrimSpace(v) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetVersionGroup 设置消费的提供者版本与分组
+func (ps *ProviderInstances) SetVersionGroup(version, group string) {
+	ps.version = version
+	ps.group = group
+}
+
+// match 判断实例的版本与分组是否与消费者配置相符
+func (ps *ProviderInstances) match(ins *registry.Instance) bool {
+	if ps.group != "*" && ins.Meta[constants.MetaGroup] != ps.group {
+		return false
+	}
+
+	version := ins.Meta[constants.MetaVersion]
+	switch {
+	case ps.version == "" || ps.version == "*":
+		return true
+	case strings.HasSuffix(ps.version, "*"):
+		return strings.HasPrefix(version, strings.TrimSuffix(ps.version, "*"))
+	default:
+		return version == ps.version
+	}
 }
 
 func (ps *ProviderInstances) StartWatcher() {
+	// 直连模式不需要监听注册中心
+	if len(ps.urls) > 0 {
+		ps.connectUrls()
+		return
+	}
 
+	if ps.reg == nil {
+		logger.Error("find provider %s error: registry is not initialized", ps.providerName)
+		ps.setReady()
+		return
+	}
+
+	go ps.reconnect()
 	for {
 		select {
 		case <-ps.Ctx.Done():
 			return
 		case <-ps.watch():
-			continue
+			ps.setReady()
 		}
 	}
 }
@@ -101,7 +444,7 @@ func (ps *ProviderInstances) StartWatcher() {
 func (ps *ProviderInstances) watch() <-chan bool {
 	logger.Debug("Servers find start")
 	// 阻塞
-	services, meta, err := consul.FindServers(ps.Ctx, ps.providerName, ps.idx)
+	services, lastIndex, err := ps.reg.Watch(ps.Ctx, ps.providerName, ps.idx)
 	logger.Debug("Servers find return")
 
 	resCh := make(chan bool, 1)
@@ -109,51 +452,174 @@ func (ps *ProviderInstances) watch() <-chan bool {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 	if err != nil {
+		// 已取消监听时链接由closeAll关闭，不修改实例
+		if ps.Ctx.Err() != nil {
+			resCh <- false
+			return resCh
+		}
+
 		logger.Error("find provider %s error:%s", ps.providerName, err)
+		for k, v := range ps.instances {
+			v.close()
+			ps.removeBreakers(k)
+		}
 		ps.instances = nil
 		resCh <- false
 		return resCh
 	}
 
+	// 仅保留版本与分组相符的实例
+	matched := make([]*registry.Instance, 0, len(services))
+	for _, s := range services {
+		if ps.match(s) {
+			matched = append(matched, s)
+		}
+	}
+	services = matched
+
 	if len(services) == 0 {
 		logger.Warn("find service: %s instance zero!", ps.providerName)
+		for k, v := range ps.instances {
+			v.close()
+			ps.removeBreakers(k)
+		}
 		ps.instances = nil
+		// 记录索引，避免无实例时重复立即返回
+		ps.setIndexLocked(lastIndex, lastIndex < ps.idx)
 		resCh <- false
 		return resCh
 	}
 
 	mp := make(map[string]*providerInstance)
+	var tasks []*dialTask
 	if ps.instances == nil {
-		ps.instances = make(map[string]*rpc.Client)
+		ps.instances = make(map[string]*providerInstance)
 	}
 
 	for _, s := range services {
 		i := &providerInstance{
-			id:   s.Service.ID,
-			host: s.Service.Address,
-			port: s.Service.Port,
+			id:   s.ID,
+			host: s.Host,
+			port: s.Port,
+			tags: s.Tags,
+			meta: s.Meta,
 		}
-		mp[s.Service.ID] = i
+		mp[s.ID] = i
 
-		// 之前不存在而现在存在的实例进行新增
-		if _, ok := ps.instances[s.Service.ID]; !ok {
-			ps.setLocked(s.Service.ID, i)
+		old, ok := ps.instances[s.ID]
+		if ok && (old.host != i.host || old.port != i.port) {
+			// 地址发生变化的实例重新建立链接
+			old.close()
+			delete(ps.instances, s.ID)
+			ok = false
 		}
-	}
 
-	ps.setInstancesIds()
+		if !ok {
+			// 之前不存在而现在存在的实例进行新增
+			tasks = append(tasks, ps.dialTaskLocked(s.ID, i))
+		} else {
+			// 之前存在现在也存在的实例保留链接，更新标签与元数据，链接已断开的重新建立
+			old.tags = i.tags
+			old.meta = i.meta
+			if old.broken() {
+				tasks = append(tasks, ps.dialTaskLocked(s.ID, old))
+			}
+		}
+	}
 
 	for k, v := range ps.instances {
 		// 之前存在现在不存在的要剔除
 		if _, ok := mp[k]; !ok {
-			_ = v.Close()
+			v.close()
 			delete(ps.instances, k)
+			ps.removeBreakers(k)
 		}
-		// 之前存在现在也存在的实例不变
 	}
+	ps.setInstancesIds()
 
-	ps.setIndexLocked(meta.LastIndex, meta.LastIndex < ps.idx)
+	// 建立链接期间不持有锁，调用可以继续选择已有的实例
+	ps.dialAndInstall(tasks)
+
+	ps.setIndexLocked(lastIndex, lastIndex < ps.idx)
 
 	resCh <- true
 	return resCh
 }
+
+// reconnect 链接断开时及定时重新建立已断开的链接，直至取消
+func (ps *ProviderInstances) reconnect() {
+	ticker := time.NewTicker(constants.ReconnectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ps.Ctx.Done():
+			return
+		case <-ps.redial:
+		case <-ticker.C:
+		}
+		ps.redialBroken()
+	}
+}
+
+func (ps *ProviderInstances) redialBroken() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var tasks []*dialTask
+	for k, inst := range ps.instances {
+		if inst.broken() {
+			tasks = append(tasks, ps.dialTaskLocked(k, inst))
+		}
+	}
+	ps.dialAndInstall(tasks)
+}
+
+// connectUrls 与直连地址建立链接，建立失败的地址定时重试，链接断开时及定时重新建立，直至取消
+func (ps *ProviderInstances) connectUrls() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ps.Ctx.Done():
+			return
+		case <-ps.redial:
+			ps.setUrls()
+		case <-timer.C:
+			ps.setUrls()
+			ps.setReady()
+			timer.Reset(constants.ReconnectInterval)
+		}
+	}
+}
+
+func (ps *ProviderInstances) setUrls() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.instances == nil {
+		ps.instances = make(map[string]*providerInstance)
+	}
+
+	var tasks []*dialTask
+	for _, u := range ps.urls {
+		if inst, ok := ps.instances[u]; ok {
+			if inst.broken() {
+				tasks = append(tasks, ps.dialTaskLocked(u, inst))
+			}
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(u)
+		if err != nil {
+			logger.Error("invalid url of provider %s: %s", ps.providerName, u)
+			continue
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			logger.Error("invalid url of provider %s: %s", ps.providerName, u)
+			continue
+		}
+
+		tasks = append(tasks, ps.dialTaskLocked(u, &providerInstance{id: u, host: host, port: p}))
+	}
+
+	ps.dialAndInstall(tasks)
+}
@@ -0,0 +1,126 @@
+package consumer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+import (
+	"github.com/ForeverSRC/morax/loadbalance"
+)
+
+func TestProviderInstances_setInstancesIds(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances []string
+		want      []string
+	}{
+		{
+			name:      "empty",
+			instances: nil,
+			want:      []string{},
+		},
+		{
+			name:      "single",
+			instances: []string{"a"},
+			want:      []string{"a"},
+		},
+		{
+			name:      "sorted",
+			instances: []string{"c", "a", "b"},
+			want:      []string{"a", "b", "c"},
+		},
+		{
+			name:      "host port ids",
+			instances: []string{"127.0.0.1:8081", "127.0.0.1:8080", "10.0.0.1:8080"},
+			want:      []string{"10.0.0.1:8080", "127.0.0.1:8080", "127.0.0.1:8081"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewProviderInstances("hello", nil)
+			for _, id := range tt.instances {
+				ps.instances[id] = &providerInstance{id: id}
+			}
+
+			ps.setInstancesIds()
+			if !reflect.DeepEqual(ps.ids, tt.want) {
+				t.Errorf("setInstancesIds() ids = %v, want %v", ps.ids, tt.want)
+			}
+		})
+	}
+}
+
+// zoneBalance 选择有zone-a标签的实例
+type zoneBalance struct{}
+
+func (zoneBalance) DoBalance(inv *loadbalance.Invocation, instanceIds []string) (string, error) {
+	for _, id := range instanceIds {
+		if _, ok := inv.Excluded[id]; !ok && inv.Instance(id).HasTag("zone-a") {
+			return id, nil
+		}
+	}
+	return "", errors.New("no instance in zone-a")
+}
+
+func TestProviderInstances_LoadBalance(t *testing.T) {
+	loadbalance.RegisterBalance("test-zone", zoneBalance{})
+
+	tests := []struct {
+		name      string
+		instances []*providerInstance
+		inv       *loadbalance.Invocation
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "select by tag",
+			instances: []*providerInstance{
+				{id: "a", tags: []string{"zone-b"}},
+				{id: "b", tags: []string{"zone-a"}},
+			},
+			want: "b",
+		},
+		{
+			name: "excluded skipped",
+			instances: []*providerInstance{
+				{id: "a", tags: []string{"zone-a"}},
+				{id: "b", tags: []string{"v1", "zone-a"}},
+			},
+			inv:  &loadbalance.Invocation{Excluded: map[string]struct{}{"a": {}}},
+			want: "b",
+		},
+		{
+			name: "direct instances without tags",
+			instances: []*providerInstance{
+				{id: "127.0.0.1:20000"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewProviderInstances("hello", nil)
+			for _, inst := range tt.instances {
+				inst.codec = &trackedCodec{}
+				ps.instances[inst.id] = inst
+			}
+			ps.setInstancesIds()
+
+			got, err := ps.LoadBalance("test-zone", tt.inv, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadBalance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LoadBalance() = %q, want %q", got, tt.want)
+			}
+			// 调用方的inv跨重试共用，不被填入实例信息
+			if tt.inv != nil && tt.inv.Instances != nil {
+				t.Errorf("LoadBalance() modified inv.Instances")
+			}
+		})
+	}
+}
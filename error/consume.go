@@ -1,9 +1,34 @@
 package error
 
+import (
+	"errors"
+)
+
+// 消费方法返回的错误，可以通过errors.Is判断
+var (
+	// ErrTimeout 调用在配置的超时时间内未完成
+	ErrTimeout = errors.New("rpc call time out")
+	// ErrShutdown consumer处于关闭阶段，不再发起调用
+	ErrShutdown = errors.New("consumer is shutting down")
+	// ErrNoInstance 没有可调用的提供者实例
+	ErrNoInstance = errors.New("no instance found")
+	// ErrNotWatching consumer尚未开始监听提供者，泛化调用需在服务启动后发起
+	ErrNotWatching = errors.New("consumer is not watching providers")
+)
+
+// RpcError 消费方法签名为func(Req) (Resp, RpcError)时返回的错误，调用成功时Err为nil
+// 新的消费方法应直接返回error
 type RpcError struct {
 	Err error
 }
 
-func (e *RpcError) Error() string {
+func (e RpcError) Error() string {
+	if e.Err == nil {
+		return "<nil>"
+	}
 	return e.Err.Error()
 }
+
+func (e RpcError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,90 @@
+package error
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code 错误码，随错误从提供者传递到消费者
+type Code string
+
+const (
+	// CodeUnknown 未知错误
+	CodeUnknown Code = "unknown"
+	// CodeNotFound 服务或方法不存在
+	CodeNotFound Code = "not_found"
+	// CodeInvalidArgument 请求参数错误
+	CodeInvalidArgument Code = "invalid_argument"
+	// CodeUnavailable 服务暂不可用，可以重试
+	CodeUnavailable Code = "unavailable"
+	// CodeTimeout 调用超时，如调用方deadline已过
+	CodeTimeout Code = "timeout"
+	// CodeInternal 提供者内部错误，如方法panic
+	CodeInternal Code = "internal"
+	// CodeBusiness 业务错误，提供方法返回的非结构化错误均视为业务错误
+	CodeBusiness Code = "business"
+)
+
+// Error 结构化错误，提供方法返回此类型的错误时，错误码、信息与详情原样传递给消费者
+type Error struct {
+	Code    Code              `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Newf(code Code, format string, a ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+// WithDetail 添加错误详情，返回错误本身
+func (e *Error) WithDetail(key, value string) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %s, message = %s", e.Code, e.Message)
+}
+
+// Is 错误码相同即视为同一错误，如errors.Is(err, error.New(error.CodeNotFound, ""))
+// 错误码为CodeTimeout时同时视为ErrTimeout
+func (e *Error) Is(target error) bool {
+	if target == ErrTimeout {
+		return e.Code == CodeTimeout
+	}
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// FromError 将错误转换为结构化错误，非结构化错误视为业务错误
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return New(CodeBusiness, err.Error())
+}
+
+// CodeOf 返回错误的错误码，err为nil时返回空，非结构化错误返回CodeUnknown
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
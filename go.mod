@@ -3,6 +3,11 @@ module github.com/ForeverSRC/morax
 go 1.16
 
 require (
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/hashicorp/consul/api v1.8.1
 	github.com/spf13/viper v1.7.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/sys v0.0.0-20200223170610-d5e6a3e2c0ae
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v2 v2.2.8
 )
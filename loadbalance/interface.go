@@ -1,5 +1,6 @@
 package loadbalance
 
+// Balance 负载均衡算法，从instanceIds中选择一个实例，实例的标签与元数据通过inv.Instance(id)获取
 type Balance interface {
-	DoBalance([]string) (string, error)
+	DoBalance(inv *Invocation, instanceIds []string) (string, error)
 }
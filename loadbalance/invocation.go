@@ -0,0 +1,64 @@
+package loadbalance
+
+// Invocation 负载均衡的调用上下文
+type Invocation struct {
+	// Excluded 本次调用中已经失败的实例ID，重试时不再选择
+	Excluded map[string]struct{}
+	// Instances 实例ID->实例信息，由消费者在选择前填入，用于按标签、元数据路由或加权，只读
+	Instances map[string]*InstanceInfo
+}
+
+// Exclude 将实例加入排除集合
+func (inv *Invocation) Exclude(id string) {
+	if inv.Excluded == nil {
+		inv.Excluded = make(map[string]struct{})
+	}
+	inv.Excluded[id] = struct{}{}
+}
+
+// Instance 返回实例信息，不存在时返回nil
+func (inv *Invocation) Instance(id string) *InstanceInfo {
+	if inv == nil {
+		return nil
+	}
+	return inv.Instances[id]
+}
+
+// InstanceInfo 实例在注册中心中的标签与元数据，直连的实例没有标签与元数据
+type InstanceInfo struct {
+	ID   string
+	Tags []string
+	Meta map[string]string
+}
+
+// HasTag 实例是否有指定的标签
+func (ii *InstanceInfo) HasTag(tag string) bool {
+	if ii == nil {
+		return false
+	}
+	for _, t := range ii.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates 过滤掉被排除的实例，返回新的切片
+// 所有实例均被排除时，返回全部实例，使重试仍可进行
+func candidates(inv *Invocation, instanceIds []string) []string {
+	res := make([]string, 0, len(instanceIds))
+	for _, id := range instanceIds {
+		if inv != nil {
+			if _, ok := inv.Excluded[id]; ok {
+				continue
+			}
+		}
+		res = append(res, id)
+	}
+
+	if len(res) == 0 {
+		res = append(res, instanceIds...)
+	}
+	return res
+}
@@ -0,0 +1,81 @@
+package loadbalance
+
+import (
+	"errors"
+	"testing"
+)
+
+// tagBalance 选择第一个有指定标签的实例
+type tagBalance struct {
+	tag string
+}
+
+func (b *tagBalance) DoBalance(inv *Invocation, instanceIds []string) (string, error) {
+	for _, id := range candidates(inv, instanceIds) {
+		if inv.Instance(id).HasTag(b.tag) {
+			return id, nil
+		}
+	}
+	return "", errors.New("no instance with tag " + b.tag)
+}
+
+func TestDoBalance_Tag(t *testing.T) {
+	RegisterBalance("test-tag", &tagBalance{tag: "zone-a"})
+
+	instances := map[string]*InstanceInfo{
+		"a": {ID: "a", Tags: []string{"zone-b"}},
+		"b": {ID: "b", Tags: []string{"v1", "zone-a"}},
+		"c": {ID: "c", Tags: []string{"zone-a"}},
+		"d": {ID: "d"},
+	}
+	tests := []struct {
+		name    string
+		inv     *Invocation
+		ids     []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "select by tag",
+			inv:  &Invocation{Instances: instances},
+			ids:  []string{"a", "b", "c", "d"},
+			want: "b",
+		},
+		{
+			name: "excluded skipped",
+			inv:  &Invocation{Instances: instances, Excluded: map[string]struct{}{"b": {}}},
+			ids:  []string{"a", "b", "c", "d"},
+			want: "c",
+		},
+		{
+			name:    "no tagged instance",
+			inv:     &Invocation{Instances: instances},
+			ids:     []string{"a", "d"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown instance",
+			inv:     &Invocation{Instances: instances},
+			ids:     []string{"x"},
+			wantErr: true,
+		},
+		{
+			name:    "nil invocation",
+			inv:     nil,
+			ids:     []string{"a", "b"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DoBalance("test-tag", tt.inv, tt.ids)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DoBalance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DoBalance() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
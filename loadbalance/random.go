@@ -1,13 +1,12 @@
 package loadbalance
 
 import (
-	"errors"
-
 	"math/rand"
 )
 
 import (
 	"github.com/ForeverSRC/morax/common/constants"
+	merr "github.com/ForeverSRC/morax/error"
 )
 
 type RandomBalance struct {
@@ -17,10 +16,11 @@ func init() {
 	RegisterBalance(constants.RandomBalance, &RandomBalance{})
 }
 
-func (r *RandomBalance) DoBalance(instanceIds []string) (string, error) {
+func (r *RandomBalance) DoBalance(inv *Invocation, instanceIds []string) (string, error) {
+	instanceIds = candidates(inv, instanceIds)
 	lens := len(instanceIds)
 	if lens == 0 {
-		return "", errors.New("no instance found")
+		return "", merr.ErrNoInstance
 	}
 
 	index := rand.Intn(lens)
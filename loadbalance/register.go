@@ -20,11 +20,11 @@ func RegisterBalance(balanceType string, b Balance) {
 	balances.allBalance[balanceType] = b
 }
 
-func DoBalance(bType string, instanceIds []string) (string, error) {
+func DoBalance(bType string, inv *Invocation, instanceIds []string) (string, error) {
 	balanceType, ok := balances.allBalance[bType]
 	if !ok {
 		return "", fmt.Errorf("un found balance type:%s\n", bType)
 	}
 
-	return balanceType.DoBalance(instanceIds)
+	return balanceType.DoBalance(inv, instanceIds)
 }
@@ -1,30 +1,31 @@
 package loadbalance
 
 import (
-	"errors"
+	"sync/atomic"
+)
+
+import (
 	"github.com/ForeverSRC/morax/common/constants"
+	merr "github.com/ForeverSRC/morax/error"
 )
 
 type RoundRobin struct {
-	curIdx int
+	curIdx uint64
 }
 
 func init() {
 	RegisterBalance(constants.RoundRobin, &RoundRobin{})
 }
 
-func (r *RoundRobin) DoBalance(instanceIds []string) (string, error) {
+func (r *RoundRobin) DoBalance(inv *Invocation, instanceIds []string) (string, error) {
+	instanceIds = candidates(inv, instanceIds)
 	lens := len(instanceIds)
 	if lens == 0 {
-		return "", errors.New("no instance found")
-	}
-
-	if r.curIdx >= lens {
-		r.curIdx = 0
+		return "", merr.ErrNoInstance
 	}
 
-	inst := instanceIds[r.curIdx]
-	r.curIdx = (r.curIdx + 1) % lens
+	idx := atomic.AddUint64(&r.curIdx, 1) - 1
+	inst := instanceIds[idx%uint64(lens)]
 
 	return inst, nil
 }
@@ -1,13 +1,13 @@
 package loadbalance
 
 import (
-	"errors"
 	"math/rand"
 	"time"
 )
 
 import (
 	"github.com/ForeverSRC/morax/common/constants"
+	merr "github.com/ForeverSRC/morax/error"
 )
 
 type ShuffleBalance struct {
@@ -17,10 +17,12 @@ func init() {
 	RegisterBalance(constants.ShuffleBalance, &ShuffleBalance{})
 }
 
-func (s *ShuffleBalance) DoBalance(instanceIds []string) (string, error) {
+// DoBalance 在候选实例的副本上打乱，不修改传入的切片
+func (s *ShuffleBalance) DoBalance(inv *Invocation, instanceIds []string) (string, error) {
+	instanceIds = candidates(inv, instanceIds)
 	lens := len(instanceIds)
 	if lens == 0 {
-		return "", errors.New("no instance found")
+		return "", merr.ErrNoInstance
 	}
 
 	rand.Seed(time.Now().UnixNano())
@@ -39,7 +39,8 @@ func init() {
 	err = log.New(os.Stderr, "[ERROR]", flags)
 }
 
-var logger *Logger
+// logger 未通过配置初始化时默认只输出error日志
+var logger = &Logger{level: errorLevel}
 
 func NewLogger(cf *cl.LoggerConfig) {
 	lev, ok := levelMap[cf.Level]
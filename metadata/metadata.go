@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"context"
+	"sync"
+)
+
+// MD 随请求与响应传递的元数据，如鉴权token、租户ID、链路追踪信息、路由提示等
+type MD map[string]string
+
+// Pairs 由key、value交替组成的列表创建元数据，个数为奇数时忽略最后一个
+func Pairs(kv ...string) MD {
+	md := make(MD, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return md
+}
+
+func (md MD) Get(key string) string {
+	return md[key]
+}
+
+func (md MD) Set(key, value string) {
+	md[key] = value
+}
+
+// Copy 返回元数据的副本
+func (md MD) Copy() MD {
+	res := make(MD, len(md))
+	for k, v := range md {
+		res[k] = v
+	}
+	return res
+}
+
+// Join 合并多个元数据，后面的覆盖前面的
+func Join(mds ...MD) MD {
+	res := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+type outgoingKey struct{}
+type incomingKey struct{}
+type responseKey struct{}
+
+// NewOutgoingContext 设置消费者发出请求时携带的元数据
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext 在已有的请求元数据基础上追加key、value
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+// FromOutgoingContext 返回消费者请求携带的元数据
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext 设置提供者收到的请求元数据，由provider在分发请求时设置
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext 返回提供者收到的请求元数据
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
+
+// Response 响应元数据的容器，并发安全
+type Response struct {
+	mu sync.Mutex
+	md MD
+}
+
+// Set 合并元数据，已存在的key被覆盖
+func (r *Response) Set(md MD) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.md = Join(r.md, md)
+}
+
+// MD 返回元数据的副本
+func (r *Response) MD() MD {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.md.Copy()
+}
+
+// NewResponseContext 返回可收集响应元数据的context
+// 消费者调用时传入该context，调用结束后从返回的Response中获取提供者返回的元数据；
+// 提供者由provider为每个请求设置，方法通过SetResponse写入返回给调用方的元数据
+func NewResponseContext(ctx context.Context) (context.Context, *Response) {
+	r := &Response{}
+	return context.WithValue(ctx, responseKey{}, r), r
+}
+
+// ResponseFromContext 返回context中的响应元数据容器
+func ResponseFromContext(ctx context.Context) (*Response, bool) {
+	r, ok := ctx.Value(responseKey{}).(*Response)
+	return r, ok
+}
+
+// SetResponse 写入响应元数据，context不能收集响应元数据时返回false
+func SetResponse(ctx context.Context, kv ...string) bool {
+	r, ok := ResponseFromContext(ctx)
+	if !ok {
+		return false
+	}
+	r.Set(Pairs(kv...))
+	return true
+}
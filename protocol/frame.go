@@ -0,0 +1,178 @@
+package protocol
+
+// morax帧协议，在一条tcp链接上多路复用请求，支持心跳与元数据帧
+// 帧格式（大端序）：
+// | magic 2 | version 1 | type 1 | codec 1 | flags 1 | request id 8 | meta length 4 | body length 4 | meta | body |
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	Version uint8 = 1
+	// HeaderSize 帧头长度
+	HeaderSize = 22
+	// MaxFrameSize 元数据与消息体（解压后）的总长度上限
+	MaxFrameSize = 64 << 20
+	// prealloc 读取帧时预先分配的最大长度，超出部分随数据到达增长，避免按未校验的帧头分配内存
+	prealloc = 64 << 10
+	// CompressThreshold 消息体达到此长度时使用gzip压缩
+	CompressThreshold = 4 << 10
+)
+
+// Magic 帧头的前两个字节，与json及流式协议的协商前缀区分
+var Magic = [2]byte{0xCA, 0xFE}
+
+// Type 帧类型
+type Type uint8
+
+const (
+	// TypeRequest 请求帧，元数据为codec.RequestHeader，消息体为请求参数
+	TypeRequest Type = 1
+	// TypeResponse 响应帧，元数据为codec.ResponseHeader，消息体为返回值，出错时为空
+	TypeResponse Type = 2
+	// TypePing 心跳请求，收到后回复请求id相同的TypePong
+	TypePing Type = 3
+	// TypePong 心跳响应
+	TypePong Type = 4
+	// TypeMetadata 元数据帧，元数据为链接级别的元数据，没有消息体
+	TypeMetadata Type = 5
+)
+
+// FlagGzip 消息体使用gzip压缩
+const FlagGzip uint8 = 1 << 0
+
+var errBadMagic = errors.New("protocol: bad magic")
+
+type Frame struct {
+	Type Type
+	// CodecID 消息体的编解码器编号
+	CodecID   uint8
+	Flags     uint8
+	RequestID uint64
+	Meta      []byte
+	Body      []byte
+}
+
+// IsMagic 判断链接开头的字节是否为帧协议
+func IsMagic(b []byte) bool {
+	return len(b) >= len(Magic) && b[0] == Magic[0] && b[1] == Magic[1]
+}
+
+// ReadFrame 读取一帧，压缩的消息体读取后解压
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var h [HeaderSize]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	if !IsMagic(h[:]) {
+		return nil, errBadMagic
+	}
+	if h[2] != Version {
+		return nil, fmt.Errorf("protocol: unsupported version %d", h[2])
+	}
+
+	f := &Frame{
+		Type:      Type(h[3]),
+		CodecID:   h[4],
+		Flags:     h[5],
+		RequestID: binary.BigEndian.Uint64(h[6:14]),
+	}
+	metaLen := int64(binary.BigEndian.Uint32(h[14:18]))
+	bodyLen := int64(binary.BigEndian.Uint32(h[18:22]))
+	size := metaLen + bodyLen
+	if size > MaxFrameSize {
+		return nil, fmt.Errorf("protocol: frame size exceeds limit")
+	}
+
+	var buf bytes.Buffer
+	if size <= prealloc {
+		buf.Grow(int(size))
+	}
+	if _, err := io.CopyN(&buf, r, size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	b := buf.Bytes()
+	f.Meta, f.Body = b[:metaLen], b[metaLen:]
+
+	if f.Flags&FlagGzip != 0 {
+		body, err := decompress(f.Body, MaxFrameSize-len(f.Meta))
+		if err != nil {
+			return nil, err
+		}
+		f.Body = body
+		f.Flags &^= FlagGzip
+	}
+	return f, nil
+}
+
+// WriteFrame 写出一帧，消息体达到CompressThreshold且压缩后更小时使用gzip压缩
+func WriteFrame(w io.Writer, f *Frame) error {
+	if len(f.Meta)+len(f.Body) > MaxFrameSize {
+		return fmt.Errorf("protocol: frame size exceeds limit")
+	}
+
+	body, flags := f.Body, f.Flags
+	if len(body) >= CompressThreshold {
+		if cb, err := compress(body); err == nil && len(cb) < len(body) {
+			body = cb
+			flags |= FlagGzip
+		}
+	}
+
+	var h [HeaderSize]byte
+	copy(h[:2], Magic[:])
+	h[2] = Version
+	h[3] = uint8(f.Type)
+	h[4] = f.CodecID
+	h[5] = flags
+	binary.BigEndian.PutUint64(h[6:14], f.RequestID)
+	binary.BigEndian.PutUint32(h[14:18], uint32(len(f.Meta)))
+	binary.BigEndian.PutUint32(h[18:22], uint32(len(body)))
+
+	for _, b := range [][]byte{h[:], f.Meta, body} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress 解压消息体，解压后超过limit时返回错误
+func decompress(b []byte, limit int) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > limit {
+		return nil, fmt.Errorf("protocol: frame size exceeds limit")
+	}
+	return body, nil
+}
@@ -0,0 +1,257 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+func TestFrame_RoundTrip(t *testing.T) {
+	random := make([]byte, 2*CompressThreshold)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name  string
+		frame *Frame
+		// gzip 写出的帧是否压缩
+		gzip bool
+	}{
+		{
+			name:  "request",
+			frame: &Frame{Type: TypeRequest, CodecID: 1, RequestID: 1, Meta: []byte("header"), Body: []byte(`{"target":"World"}`)},
+		},
+		{
+			name:  "response without body",
+			frame: &Frame{Type: TypeResponse, CodecID: 2, RequestID: 1<<64 - 1, Meta: []byte("error")},
+		},
+		{
+			name:  "ping",
+			frame: &Frame{Type: TypePing, RequestID: 7},
+		},
+		{
+			name:  "metadata",
+			frame: &Frame{Type: TypeMetadata, Meta: []byte("app=hello")},
+		},
+		{
+			name:  "compressible body",
+			frame: &Frame{Type: TypeRequest, CodecID: 1, RequestID: 2, Meta: []byte("header"), Body: bytes.Repeat([]byte("morax"), CompressThreshold)},
+			gzip:  true,
+		},
+		{
+			name:  "below threshold",
+			frame: &Frame{Type: TypeRequest, CodecID: 1, RequestID: 3, Body: bytes.Repeat([]byte("a"), CompressThreshold-1)},
+		},
+		{
+			name:  "incompressible body",
+			frame: &Frame{Type: TypeResponse, CodecID: 3, RequestID: 4, Body: random},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteFrame(&buf, tt.frame); err != nil {
+				t.Fatalf("WriteFrame() error = %v", err)
+			}
+			if gz := buf.Bytes()[5]&FlagGzip != 0; gz != tt.gzip {
+				t.Errorf("WriteFrame() gzip = %v, want %v", gz, tt.gzip)
+			}
+
+			got, err := ReadFrame(&buf)
+			if err != nil {
+				t.Fatalf("ReadFrame() error = %v", err)
+			}
+			want := tt.frame
+			if got.Type != want.Type || got.CodecID != want.CodecID || got.Flags != want.Flags || got.RequestID != want.RequestID {
+				t.Errorf("ReadFrame() header = %+v, want %+v", got, want)
+			}
+			if !bytes.Equal(got.Meta, want.Meta) {
+				t.Errorf("ReadFrame() meta = %q, want %q", got.Meta, want.Meta)
+			}
+			if !bytes.Equal(got.Body, want.Body) {
+				t.Errorf("ReadFrame() body length = %d, want %d", len(got.Body), len(want.Body))
+			}
+			if buf.Len() != 0 {
+				t.Errorf("ReadFrame() left %d bytes unread", buf.Len())
+			}
+		})
+	}
+}
+
+func TestFrame_Sequence(t *testing.T) {
+	var buf bytes.Buffer
+	for i := uint64(1); i <= 3; i++ {
+		if err := WriteFrame(&buf, &Frame{Type: TypeRequest, RequestID: i, Body: []byte{byte(i)}}); err != nil {
+			t.Fatalf("WriteFrame() error = %v", err)
+		}
+	}
+	for i := uint64(1); i <= 3; i++ {
+		f, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("ReadFrame() error = %v", err)
+		}
+		if f.RequestID != i || !bytes.Equal(f.Body, []byte{byte(i)}) {
+			t.Errorf("ReadFrame() = %+v, want request id %d", f, i)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Errorf("ReadFrame() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReadFrame_Invalid(t *testing.T) {
+	valid := func() []byte {
+		var buf bytes.Buffer
+		_ = WriteFrame(&buf, &Frame{Type: TypeRequest, RequestID: 1, Meta: []byte("meta"), Body: []byte("body")})
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name   string
+		modify func(b []byte) []byte
+		want   error
+	}{
+		{
+			name:   "empty",
+			modify: func(b []byte) []byte { return nil },
+			want:   io.EOF,
+		},
+		{
+			name:   "truncated header",
+			modify: func(b []byte) []byte { return b[:HeaderSize-1] },
+			want:   io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "truncated body",
+			modify: func(b []byte) []byte { return b[:len(b)-1] },
+			want:   io.ErrUnexpectedEOF,
+		},
+		{
+			name: "bad magic",
+			modify: func(b []byte) []byte {
+				b[0] = '{'
+				return b
+			},
+			want: errBadMagic,
+		},
+		{
+			name: "unsupported version",
+			modify: func(b []byte) []byte {
+				b[2] = Version + 1
+				return b
+			},
+		},
+		{
+			name: "meta too large",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[14:18], MaxFrameSize+1)
+				return b
+			},
+		},
+		{
+			name: "body too large",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[18:22], MaxFrameSize+1)
+				return b
+			},
+		},
+		{
+			name: "meta and body together too large",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[14:18], MaxFrameSize/2+1)
+				binary.BigEndian.PutUint32(b[18:22], MaxFrameSize/2)
+				return b
+			},
+		},
+		{
+			name: "bad gzip body",
+			modify: func(b []byte) []byte {
+				b[5] |= FlagGzip
+				return b
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ReadFrame(bytes.NewReader(tt.modify(valid())))
+			if err == nil {
+				t.Fatalf("ReadFrame() = %+v, want error", f)
+			}
+			if tt.want != nil && err != tt.want {
+				t.Errorf("ReadFrame() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFrame_TruncatedLarge(t *testing.T) {
+	var buf bytes.Buffer
+	_ = WriteFrame(&buf, &Frame{Type: TypeRequest, RequestID: 1, Body: []byte("body")})
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[18:22], MaxFrameSize)
+
+	// 帧头声明的长度在上限内但数据未到达时，不按帧头分配内存
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ReadFrame(bytes.NewReader(b))
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFrame() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("ReadFrame() allocated %d bytes", alloc)
+	}
+}
+
+func TestWriteFrame_TooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		f    *Frame
+	}{
+		{
+			name: "meta too large",
+			f:    &Frame{Type: TypeRequest, Meta: make([]byte, MaxFrameSize+1)},
+		},
+		{
+			name: "meta and body together too large",
+			f:    &Frame{Type: TypeRequest, Meta: make([]byte, MaxFrameSize/2+1), Body: make([]byte, MaxFrameSize/2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteFrame(&buf, tt.f); err == nil {
+				t.Fatal("WriteFrame() want error")
+			}
+			if buf.Len() != 0 {
+				t.Errorf("WriteFrame() wrote %d bytes", buf.Len())
+			}
+		})
+	}
+}
+
+func TestIsMagic(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want bool
+	}{
+		{name: "magic", b: []byte{0xCA, 0xFE, Version}, want: true},
+		{name: "json", b: []byte(`{"method"`), want: false},
+		{name: "stream preface", b: []byte("MORAX json\n"), want: false},
+		{name: "short", b: []byte{0xCA}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMagic(tt.b); got != tt.want {
+				t.Errorf("IsMagic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
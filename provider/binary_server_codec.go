@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"bufio"
+	"io"
+	"net/rpc"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/codec"
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/logger"
+)
+
+// invalidRequest 出错时写出的响应体
+var invalidRequest = struct{}{}
+
+// BinaryServerCodec 使用二进制编解码器的服务端编解码器，参考net/rpc包中的gobServerCodec
+// 每条消息依次为消息头与消息体，请求的seq即为消费者的请求id
+type BinaryServerCodec struct {
+	*codecConn
+	dec    codec.Decoder
+	enc    codec.Encoder
+	encBuf *bufio.Writer
+
+	req codec.RequestHeader
+	// deadline 当前读取的请求的调用方deadline
+	deadline time.Time
+}
+
+func NewBinaryServerCodec(conn io.ReadWriteCloser, cd codec.Codec, p *RpcProvider) ServerCodec {
+	return newBinaryServerCodec(newCodecConn(conn, p), conn, cd)
+}
+
+// newBinaryServerCodec 从r读取请求，协商编解码器时r为带缓冲的链接
+func newBinaryServerCodec(cc *codecConn, r io.Reader, cd codec.Codec) *BinaryServerCodec {
+	buf := bufio.NewWriter(cc.conn)
+	return &BinaryServerCodec{
+		codecConn: cc,
+		dec:       cd.NewDecoder(r),
+		enc:       cd.NewEncoder(buf),
+		encBuf:    buf,
+	}
+}
+
+func (c *BinaryServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	// 判断是否处于关闭状态
+	if c.isClose.IsSet() {
+		return io.EOF
+	}
+
+	c.req = codec.RequestHeader{}
+	if err := c.dec.Decode(&c.req); err != nil {
+		return err
+	}
+	r.ServiceMethod = c.req.ServiceMethod
+	r.Seq = c.req.Seq
+	c.deadline = deadlineOf(c.req.Timeout)
+
+	c.newRequest(r.Seq, r.ServiceMethod, c.req.Meta, c.deadline)
+	return nil
+}
+
+func (c *BinaryServerCodec) ReadRequestBody(x interface{}) error {
+	// 判断是否处于关闭状态
+	if c.isClose.IsSet() {
+		return io.EOF
+	}
+
+	// 请求体总是需要读出，保证下一个请求从消息头开始
+	if err := c.dec.Decode(x); err != nil || x == nil {
+		return err
+	}
+	// 调用方已放弃等待时不再执行方法，分发器将错误作为响应返回
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return errDeadlineExceeded
+	}
+
+	c.setContext(c.req.Seq, x)
+	return nil
+}
+
+// 由分发器加锁后调用
+func (c *BinaryServerCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	h := codec.ResponseHeader{
+		ServiceMethod: r.ServiceMethod,
+		Seq:           r.Seq,
+		Error:         r.Error,
+		Meta:          c.finish(r.Seq),
+	}
+	if r.Error != "" {
+		if e, ok := x.(*merr.Error); ok {
+			h.Status = e
+		}
+		x = invalidRequest
+	}
+
+	if err := c.enc.Encode(&h); err != nil {
+		return c.closeOnEncodeError(err)
+	}
+	if err := c.enc.Encode(x); err != nil {
+		return c.closeOnEncodeError(err)
+	}
+	return c.encBuf.Flush()
+}
+
+// closeOnEncodeError 编码失败时消息流已无法恢复，关闭链接
+func (c *BinaryServerCodec) closeOnEncodeError(err error) error {
+	if c.encBuf.Flush() == nil {
+		logger.Error("rpc: error encoding response: %s", err)
+	}
+	_ = c.Close()
+	return err
+}
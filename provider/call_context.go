@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+)
+
+// ContextSetter 入参实现此接口时，provider在调用方法前注入该请求的context
+type ContextSetter interface {
+	SetContext(ctx context.Context)
+}
+
+// CallContext 可嵌入到入参结构体中，用于获取该请求的context
+// 与方法的context.Context入参相同，携带调用方的deadline与调用信息
+// 在deadline到达、链接关闭、优雅关机超时或响应写出后取消
+type CallContext struct {
+	ctx context.Context
+}
+
+func (cc *CallContext) SetContext(ctx context.Context) {
+	cc.ctx = ctx
+}
+
+func (cc CallContext) Context() context.Context {
+	if cc.ctx == nil {
+		return context.Background()
+	}
+	return cc.ctx
+}
+
+type callInfoKey struct{}
+
+// CallInfo 请求的调用信息，由provider放入请求的context
+type CallInfo struct {
+	// ServiceMethod 格式为"服务名.方法名"
+	ServiceMethod string
+	// RemoteAddr 调用方地址
+	RemoteAddr string
+}
+
+func withCallInfo(ctx context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFromContext 从请求的context中获取调用信息
+func CallInfoFromContext(ctx context.Context) (*CallInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info, ok
+}
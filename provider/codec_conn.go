@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/codec"
+	"github.com/ForeverSRC/morax/common/constants"
+	"github.com/ForeverSRC/morax/common/types"
+	"github.com/ForeverSRC/morax/metadata"
+	"github.com/ForeverSRC/morax/protocol"
+)
+
+// codecConn 编解码器绑定的链接，各编解码器共用
+// 维护链接的关闭状态以及每个请求的context，provider通过codecConn跟踪链接，优雅关机时关闭空闲链接
+type codecConn struct {
+	conn    io.ReadWriteCloser
+	isClose types.AtomicBool
+	server  *RpcProvider
+	// remoteAddr 调用方地址
+	remoteAddr string
+	// ctx 链接关闭或provider取消全部请求时取消，作为所有请求context的父context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	ctxMu sync.Mutex // protects ctxs, cancels, responses
+	// ctxs 请求seq->请求context
+	ctxs map[uint64]context.Context
+	// responses 请求seq->响应元数据
+	responses map[uint64]*metadata.Response
+	// cancels 请求seq->请求context的取消函数
+	cancels map[uint64]context.CancelFunc
+}
+
+func newCodecConn(conn io.ReadWriteCloser, p *RpcProvider) *codecConn {
+	c := &codecConn{
+		conn:      conn,
+		server:    p,
+		ctxs:      make(map[uint64]context.Context),
+		responses: make(map[uint64]*metadata.Response),
+		cancels:   make(map[uint64]context.CancelFunc),
+	}
+	if nc, ok := conn.(net.Conn); ok {
+		c.remoteAddr = nc.RemoteAddr().String()
+	}
+	c.ctx, c.cancel = context.WithCancel(p.ctx)
+	c.isClose.SetFalse()
+	p.TrackCodec(c, true)
+	return c
+}
+
+// negotiate 根据链接开头的字节选择协议：帧协议的magic；流式协议中消费者写入的协商前缀，未写入前缀时使用json
+// 流式协议中provider不接受该编解码器时返回错误，帧协议中按每个请求的编解码器判断
+func (c *codecConn) negotiate() (ServerCodec, error) {
+	br := bufio.NewReader(c.conn)
+	if b, err := br.Peek(len(protocol.Magic)); err == nil && protocol.IsMagic(b) {
+		return newFramedServerCodec(c, br), nil
+	}
+
+	name := constants.JsonCodec
+	if b, err := br.Peek(len(constants.CodecPreface)); err == nil && string(b) == constants.CodecPreface {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		name = strings.TrimSpace(strings.TrimPrefix(line, constants.CodecPreface))
+	}
+
+	if !c.server.supportCodec(name) {
+		return nil, fmt.Errorf("codec %s is not accepted", name)
+	}
+	if name == constants.JsonCodec {
+		return newJsonServerCodec(c, br), nil
+	}
+
+	cd, err := codec.GetCodec(name)
+	if err != nil {
+		return nil, err
+	}
+	return newBinaryServerCodec(c, br, cd), nil
+}
+
+// deadlineOf 根据调用方剩余的时间预算计算deadline，未携带时为零值
+func deadlineOf(timeout int64) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(timeout) * time.Millisecond)
+}
+
+// newRequest 为请求创建context，携带调用信息、请求元数据与响应元数据容器
+// 在调用方deadline到达、链接关闭、provider取消全部请求或响应写出后取消
+func (c *codecConn) newRequest(seq uint64, serviceMethod string, md metadata.MD, deadline time.Time) {
+	ctx := withCallInfo(c.ctx, &CallInfo{
+		ServiceMethod: serviceMethod,
+		RemoteAddr:    c.remoteAddr,
+	})
+
+	if md == nil {
+		md = metadata.MD{}
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx, resp := metadata.NewResponseContext(ctx)
+
+	var cancel context.CancelFunc
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+
+	c.ctxMu.Lock()
+	defer c.ctxMu.Unlock()
+	c.ctxs[seq] = ctx
+	c.responses[seq] = resp
+	c.cancels[seq] = cancel
+}
+
+// Context 返回seq对应请求的context，请求不存在时返回链接的context
+func (c *codecConn) Context(seq uint64) context.Context {
+	c.ctxMu.Lock()
+	defer c.ctxMu.Unlock()
+	if ctx, ok := c.ctxs[seq]; ok {
+		return ctx
+	}
+	return c.ctx
+}
+
+// setContext 入参实现ContextSetter时注入请求的context
+func (c *codecConn) setContext(seq uint64, x interface{}) {
+	if cs, ok := x.(ContextSetter); ok {
+		cs.SetContext(c.Context(seq))
+	}
+}
+
+// finish 响应写出前取消请求的context，返回响应元数据
+func (c *codecConn) finish(seq uint64) metadata.MD {
+	c.ctxMu.Lock()
+	defer c.ctxMu.Unlock()
+	delete(c.ctxs, seq)
+	if cancel, ok := c.cancels[seq]; ok {
+		cancel()
+		delete(c.cancels, seq)
+	}
+	resp, ok := c.responses[seq]
+	if !ok {
+		return nil
+	}
+	delete(c.responses, seq)
+	return resp.MD()
+}
+
+// cancelConn 读取请求结束时取消链接的context，进行中的请求随之取消
+func (c *codecConn) cancelConn() {
+	c.cancel()
+}
+
+func (c *codecConn) Close() error {
+	if c.isClose.IsSet() {
+		return nil
+	}
+
+	c.isClose.SetTrue()
+	c.cancel()
+	err := c.conn.Close()
+	c.server.TrackCodec(c, false)
+	return err
+}
+
+func (c *codecConn) closeIdle() (bool, error) {
+	if c.isClose.IsSet() {
+		return true, nil
+	}
+
+	rc, ok := c.conn.(*rpcConn)
+	if !ok {
+		return false, nil
+	}
+	st, unixSec := rc.getState()
+
+	if st == http.StateNew && unixSec < time.Now().Unix()-5 {
+		st = http.StateIdle
+	}
+	if st != http.StateIdle || unixSec == 0 {
+		return false, nil
+	}
+	c.isClose.SetTrue()
+	c.cancel()
+	err := c.conn.Close()
+	c.server.TrackCodec(c, false)
+	return true, err
+
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/codec"
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/metadata"
+	"github.com/ForeverSRC/morax/protocol"
+)
+
+// FramedServerCodec 帧协议的服务端编解码器
+// 每个请求帧的消息体可以使用不同的编解码器，心跳与元数据帧在读取请求时处理，不经过分发器
+type FramedServerCodec struct {
+	*codecConn
+	r io.Reader
+
+	wmu sync.Mutex // protects w, 响应与心跳响应可能并发写出
+	w   *bufio.Writer
+
+	frame *protocol.Frame
+	req   codec.RequestHeader
+	// deadline 当前读取的请求的调用方deadline
+	deadline time.Time
+	// connMeta 元数据帧携带的链接元数据，合并到每个请求的元数据中，只在读取请求的goroutine中访问
+	connMeta metadata.MD
+
+	mutex sync.Mutex // protects codecs
+	// codecs 请求id->请求使用的编解码器，响应使用相同的编解码器
+	codecs map[uint64]uint8
+}
+
+func NewFramedServerCodec(conn io.ReadWriteCloser, p *RpcProvider) ServerCodec {
+	return newFramedServerCodec(newCodecConn(conn, p), conn)
+}
+
+// newFramedServerCodec 从r读取请求，协商协议时r为带缓冲的链接
+func newFramedServerCodec(cc *codecConn, r io.Reader) *FramedServerCodec {
+	return &FramedServerCodec{
+		codecConn: cc,
+		r:         r,
+		w:         bufio.NewWriter(cc.conn),
+		codecs:    make(map[uint64]uint8),
+	}
+}
+
+func (c *FramedServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		// 判断是否处于关闭状态
+		if c.isClose.IsSet() {
+			return io.EOF
+		}
+
+		f, err := protocol.ReadFrame(c.r)
+		if err != nil {
+			return err
+		}
+
+		switch f.Type {
+		case protocol.TypePing:
+			if err = c.writeFrame(&protocol.Frame{Type: protocol.TypePong, RequestID: f.RequestID}); err != nil {
+				return err
+			}
+		case protocol.TypePong:
+		case protocol.TypeMetadata:
+			md, err := codec.UnmarshalMetadata(f.Meta)
+			if err != nil {
+				return err
+			}
+			c.connMeta = metadata.Join(c.connMeta, md)
+		case protocol.TypeRequest:
+			return c.readRequest(f, r)
+		default:
+			return fmt.Errorf("protocol: unexpected frame type %d", f.Type)
+		}
+	}
+}
+
+func (c *FramedServerCodec) readRequest(f *protocol.Frame, r *rpc.Request) error {
+	if err := c.req.Unmarshal(f.Meta); err != nil {
+		return err
+	}
+	c.frame = f
+	r.ServiceMethod = c.req.ServiceMethod
+	r.Seq = f.RequestID
+	c.deadline = deadlineOf(c.req.Timeout)
+
+	c.mutex.Lock()
+	c.codecs[r.Seq] = f.CodecID
+	c.mutex.Unlock()
+
+	// 请求自身的元数据优先于链接元数据
+	md := c.req.Meta
+	if len(c.connMeta) > 0 {
+		md = metadata.Join(c.connMeta, c.req.Meta)
+	}
+	c.newRequest(r.Seq, r.ServiceMethod, md, c.deadline)
+	return nil
+}
+
+func (c *FramedServerCodec) ReadRequestBody(x interface{}) error {
+	// 判断是否处于关闭状态
+	if c.isClose.IsSet() {
+		return io.EOF
+	}
+
+	// 消息体已随请求帧读出
+	if x == nil {
+		return nil
+	}
+
+	cd, err := codec.GetCodecByID(c.frame.CodecID)
+	if err != nil || !c.server.supportCodec(cd.Name()) {
+		return merr.Newf(merr.CodeInvalidArgument, "rpc: codec %d is not accepted", c.frame.CodecID)
+	}
+	if err = codec.Unmarshal(cd, c.frame.Body, x); err != nil {
+		return err
+	}
+	// 调用方已放弃等待时不再执行方法，分发器将错误作为响应返回
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return errDeadlineExceeded
+	}
+
+	c.setContext(c.frame.RequestID, x)
+	return nil
+}
+
+// WriteResponse 响应使用与请求相同的编解码器，返回值编码失败时返回错误响应，不影响链接上的其余请求
+func (c *FramedServerCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	c.mutex.Lock()
+	codecId, ok := c.codecs[r.Seq]
+	delete(c.codecs, r.Seq)
+	c.mutex.Unlock()
+	if !ok {
+		return errors.New("invalid sequence number in response")
+	}
+
+	h := codec.ResponseHeader{Error: r.Error, Meta: c.finish(r.Seq)}
+	var body []byte
+	if r.Error == "" {
+		var err error
+		if body, err = c.marshalReply(codecId, x); err != nil {
+			logger.Error("rpc: error encoding response of %s: %s", r.ServiceMethod, err)
+			h.Status = merr.New(merr.CodeInternal, "rpc: cannot encode response: "+err.Error())
+			h.Error = h.Status.Error()
+		}
+	} else if e, ok := x.(*merr.Error); ok {
+		h.Status = e
+	}
+
+	return c.writeFrame(&protocol.Frame{
+		Type:      protocol.TypeResponse,
+		CodecID:   codecId,
+		RequestID: r.Seq,
+		Meta:      h.Marshal(),
+		Body:      body,
+	})
+}
+
+func (c *FramedServerCodec) marshalReply(codecId uint8, x interface{}) ([]byte, error) {
+	cd, err := codec.GetCodecByID(codecId)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(cd, x)
+}
+
+func (c *FramedServerCodec) writeFrame(f *protocol.Frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := protocol.WriteFrame(c.w, f); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
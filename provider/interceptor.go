@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"context"
+)
+
+import (
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+// Call 一次提供方法调用的信息，在拦截器链中传递
+type Call struct {
+	// ServiceMethod 格式为"服务名.方法名"
+	ServiceMethod string
+	// RemoteAddr 调用方地址
+	RemoteAddr string
+	// Args 方法的参数
+	Args interface{}
+	// Metadata 请求元数据，响应元数据通过metadata.SetResponse(ctx, ...)写入
+	Metadata metadata.MD
+	// Reply 指向方法返回值的指针，方法执行后写入结果
+	Reply interface{}
+}
+
+// Handler 执行方法，返回方法的错误
+type Handler func(ctx context.Context, call *Call) error
+
+// Interceptor 提供方法的拦截器
+// 拦截器通过调用next执行方法，不调用next时方法不被执行，返回的错误作为响应的错误
+type Interceptor interface {
+	Intercept(ctx context.Context, call *Call, next Handler) error
+}
+
+// InterceptorFunc 函数形式的拦截器
+type InterceptorFunc func(ctx context.Context, call *Call, next Handler) error
+
+func (f InterceptorFunc) Intercept(ctx context.Context, call *Call, next Handler) error {
+	return f(ctx, call, next)
+}
+
+// AddInterceptor 添加拦截器，按添加顺序由外到内执行
+func (p *RpcProvider) AddInterceptor(i Interceptor) {
+	p.server.addInterceptor(i)
+}
@@ -1,13 +1,14 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"net/rpc"
 	"strings"
 )
 
 import (
+	"github.com/ForeverSRC/morax/codec"
 	"github.com/ForeverSRC/morax/common/types"
 	cp "github.com/ForeverSRC/morax/config/provider"
 	"github.com/ForeverSRC/morax/logger"
@@ -15,40 +16,70 @@ import (
 
 type RpcProvider struct {
 	RpcAddr string
-	server  *rpc.Server
+	server  *server
+	// supportedCodecs 接受的编解码器，在注册中心的元数据中声明
+	supportedCodecs []string
 	types.AbstractService
-	codecs map[*JsonServerCodec]struct{}
+	// codecs 所有链接，优雅关机时关闭空闲链接
+	codecs map[*codecConn]struct{}
+	// ctx 所有请求context的根context，CancelRequests时取消
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewRpcProvider(host string, pvf *cp.ProviderConfig) *RpcProvider {
 	pro := &RpcProvider{
-		RpcAddr: fmt.Sprintf("%s:%d", host, pvf.Service.Port),
-		server:  rpc.NewServer(),
+		RpcAddr:         fmt.Sprintf("%s:%d", host, pvf.Service.Port),
+		server:          newServer(),
+		supportedCodecs: pvf.Service.Codecs,
 	}
+	if len(pro.supportedCodecs) == 0 {
+		pro.supportedCodecs = codec.Names()
+	}
+	pro.ctx, pro.cancel = context.WithCancel(context.Background())
 	pro.InShutdown.SetFalse()
 	return pro
 }
 
 // methods 是一个结构体指针
+// 方法签名为func(args T, reply *R) error 或 func(ctx context.Context, args T, reply *R) error
 func (p *RpcProvider) RegisterProvider(name string, methods interface{}) error {
-	return p.server.RegisterName(name, methods)
+	return p.server.register(name, methods)
 }
 
-func (p *RpcProvider) ListenAndServe() {
-	go p.serveRpc()
+// Codecs 返回接受的编解码器
+func (p *RpcProvider) Codecs() []string {
+	return p.supportedCodecs
 }
 
-func (p *RpcProvider) serveRpc() {
+func (p *RpcProvider) supportCodec(name string) bool {
+	for _, c := range p.supportedCodecs {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe 同步完成监听，在单独的goroutine中接受链接
+func (p *RpcProvider) ListenAndServe() error {
 	if p.InShuttingDown() {
-		return
+		return fmt.Errorf("provider is shutting down")
 	}
 
 	listener, err := net.Listen("tcp", p.RpcAddr)
 	if err != nil {
-		logger.Fatal("listen tcp error", err)
+		return fmt.Errorf("listen tcp error: %s", err)
 	}
 	logger.Info("rpc:start listening on %s", p.RpcAddr)
+
+	go p.serveRpc(listener)
+	return nil
+}
+
+func (p *RpcProvider) serveRpc(listener net.Listener) {
 	if !p.TrackListener(&listener, true) {
+		_ = listener.Close()
 		return
 	}
 	// 关闭listener后 accept返回，goroutine退出，移除listener
@@ -79,9 +110,15 @@ func (p *RpcProvider) handleRpc(conn net.Conn) {
 		}
 	}()
 	rc := NewConn(conn)
-	codec := NewJsonServerCodec(rc, p)
+	cc := newCodecConn(rc, p)
+	codec, err := cc.negotiate()
+	if err != nil {
+		logger.Error("rpc: negotiate codec with %s error: %s", cc.remoteAddr, err)
+		_ = cc.Close()
+		return
+	}
 
-	p.server.ServeCodec(codec)
+	p.server.serveCodec(codec)
 	logger.Debug("rpc serve codec return")
 }
 
@@ -94,6 +131,11 @@ func (p *RpcProvider) Shutdown() error {
 	return p.CloseListenersLocked()
 }
 
+// CancelRequests 取消所有进行中请求的context，用于优雅关机超时后通知方法尽快返回
+func (p *RpcProvider) CancelRequests() {
+	p.cancel()
+}
+
 func (p *RpcProvider) CloseIdleCodecs() bool {
 	quiescent := true
 
@@ -105,11 +147,11 @@ func (p *RpcProvider) CloseIdleCodecs() bool {
 	return quiescent
 }
 
-func (p *RpcProvider) TrackCodec(codec *JsonServerCodec, add bool) {
+func (p *RpcProvider) TrackCodec(codec *codecConn, add bool) {
 	p.Mu.Lock()
 	defer p.Mu.Unlock()
 	if p.codecs == nil {
-		p.codecs = make(map[*JsonServerCodec]struct{})
+		p.codecs = make(map[*codecConn]struct{})
 	}
 	if add {
 		p.codecs[codec] = struct{}{}
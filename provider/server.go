@@ -0,0 +1,327 @@
+package provider
+
+// 参考net/rpc包中的rpc.Server实现方法分发，在其基础上支持方法接收请求的context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+import (
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/metadata"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ServerCodec 在rpc.ServerCodec的基础上，提供每个请求的context
+// 请求出错时，WriteResponse的body为描述该错误的*error.Error，编解码器应将其写入响应
+type ServerCodec interface {
+	rpc.ServerCodec
+	// Context 返回seq对应请求的context，在ReadRequestHeader之后可用
+	Context(seq uint64) context.Context
+}
+
+// methodType 提供的方法，支持的签名：
+// func (s *S) Method(args T, reply *R) error
+// func (s *S) Method(ctx context.Context, args T, reply *R) error
+type methodType struct {
+	method    reflect.Method
+	argType   reflect.Type
+	replyType reflect.Type
+	// withCtx 第一个入参为context.Context
+	withCtx bool
+}
+
+type service struct {
+	name    string
+	rcvr    reflect.Value
+	methods map[string]*methodType
+}
+
+// server 方法分发器，serviceName.methodName -> 方法
+type server struct {
+	mu       sync.RWMutex
+	services map[string]*service
+	// interceptors 方法调用的拦截器，按添加顺序由外到内执行
+	interceptors []Interceptor
+}
+
+func newServer() *server {
+	return &server{services: make(map[string]*service)}
+}
+
+func (server *server) register(name string, rcvr interface{}) error {
+	if name == "" {
+		return errors.New("rpc.Register: no service name for type " + reflect.TypeOf(rcvr).String())
+	}
+
+	s := &service{
+		name:    name,
+		rcvr:    reflect.ValueOf(rcvr),
+		methods: suitableMethods(reflect.TypeOf(rcvr)),
+	}
+	if len(s.methods) == 0 {
+		return fmt.Errorf("rpc.Register: type %s has no exported methods of suitable type", s.rcvr.Type())
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, dup := server.services[name]; dup {
+		return errors.New("rpc: service already defined: " + name)
+	}
+	server.services[name] = s
+	return nil
+}
+
+func (server *server) addInterceptor(i Interceptor) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.interceptors = append(server.interceptors, i)
+}
+
+// handler 返回经过拦截器链的方法调用
+func (server *server) handler(core Handler) Handler {
+	server.mu.RLock()
+	interceptors := server.interceptors
+	server.mu.RUnlock()
+
+	next := core
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, n := interceptors[i], next
+		next = func(ctx context.Context, call *Call) error {
+			return ic.Intercept(ctx, call, n)
+		}
+	}
+	return next
+}
+
+func suitableMethods(typ reflect.Type) map[string]*methodType {
+	methods := make(map[string]*methodType)
+	for m := 0; m < typ.NumMethod(); m++ {
+		method := typ.Method(m)
+		mtype := method.Type
+		if method.PkgPath != "" {
+			continue
+		}
+
+		// 第一个入参为接收者
+		mt := &methodType{method: method}
+		switch mtype.NumIn() {
+		case 3:
+		case 4:
+			if mtype.In(1) != contextType {
+				logger.Debug("rpc.Register: method %q first param should be context.Context", method.Name)
+				continue
+			}
+			mt.withCtx = true
+		default:
+			continue
+		}
+
+		mt.argType = mtype.In(mtype.NumIn() - 2)
+		if !isExportedOrBuiltinType(mt.argType) {
+			logger.Debug("rpc.Register: argument type of method %q is not exported: %q", method.Name, mt.argType)
+			continue
+		}
+		mt.replyType = mtype.In(mtype.NumIn() - 1)
+		if mt.replyType.Kind() != reflect.Ptr || !isExportedOrBuiltinType(mt.replyType) {
+			logger.Debug("rpc.Register: reply type of method %q is not an exported pointer: %q", method.Name, mt.replyType)
+			continue
+		}
+		if mtype.NumOut() != 1 || mtype.Out(0) != errorType {
+			logger.Debug("rpc.Register: method %q should return only error", method.Name)
+			continue
+		}
+		methods[method.Name] = mt
+	}
+	return methods
+}
+
+func isExportedOrBuiltinType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return token.IsExported(t.Name()) || t.PkgPath() == ""
+}
+
+// connCanceler 链接的context可以取消的编解码器
+type connCanceler interface {
+	cancelConn()
+}
+
+// serveCodec 循环读取请求，每个请求在单独的goroutine中执行
+// 读取请求头出错时不再读取新的请求，取消链接上所有请求的context，等待进行中的请求结束后关闭codec
+func (server *server) serveCodec(codec ServerCodec) {
+	sending := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for {
+		svc, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec)
+		if err != nil {
+			if err != io.EOF {
+				logger.Debug("rpc: %s", err)
+			}
+			if !keepReading {
+				break
+			}
+			if req != nil {
+				server.sendResponse(sending, req, nil, codec, err)
+			}
+			continue
+		}
+		wg.Add(1)
+		go svc.call(server, sending, wg, mtype, req, argv, replyv, codec)
+	}
+	// 调用方已断开，进行中的请求无需继续执行
+	if cc, ok := codec.(connCanceler); ok {
+		cc.cancelConn()
+	}
+	wg.Wait()
+	_ = codec.Close()
+}
+
+func (server *server) readRequest(codec ServerCodec) (svc *service, mtype *methodType, req *rpc.Request, argv, replyv reflect.Value, keepReading bool, err error) {
+	svc, mtype, req, keepReading, err = server.readRequestHeader(codec)
+	if err != nil {
+		if !keepReading {
+			return
+		}
+		// 丢弃请求体
+		_ = codec.ReadRequestBody(nil)
+		return
+	}
+
+	argIsValue := false
+	if mtype.argType.Kind() == reflect.Ptr {
+		argv = reflect.New(mtype.argType.Elem())
+	} else {
+		argv = reflect.New(mtype.argType)
+		argIsValue = true
+	}
+	if err = codec.ReadRequestBody(argv.Interface()); err != nil {
+		if _, ok := err.(*merr.Error); !ok {
+			err = merr.New(merr.CodeInvalidArgument, "rpc: cannot decode request body: "+err.Error())
+		}
+		return
+	}
+	if argIsValue {
+		argv = argv.Elem()
+	}
+
+	replyv = reflect.New(mtype.replyType.Elem())
+	switch mtype.replyType.Elem().Kind() {
+	case reflect.Map:
+		replyv.Elem().Set(reflect.MakeMap(mtype.replyType.Elem()))
+	case reflect.Slice:
+		replyv.Elem().Set(reflect.MakeSlice(mtype.replyType.Elem(), 0, 0))
+	}
+	return
+}
+
+func (server *server) readRequestHeader(codec ServerCodec) (svc *service, mtype *methodType, req *rpc.Request, keepReading bool, err error) {
+	req = new(rpc.Request)
+	err = codec.ReadRequestHeader(req)
+	if err != nil {
+		req = nil
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		err = errors.New("rpc: server cannot decode request: " + err.Error())
+		return
+	}
+
+	// 请求头读取成功后，即使出错也可以继续读取下一个请求
+	keepReading = true
+
+	dot := strings.LastIndex(req.ServiceMethod, ".")
+	if dot < 0 {
+		err = merr.New(merr.CodeInvalidArgument, "rpc: service/method request ill-formed: "+req.ServiceMethod)
+		return
+	}
+	serviceName := req.ServiceMethod[:dot]
+	methodName := req.ServiceMethod[dot+1:]
+
+	server.mu.RLock()
+	svc = server.services[serviceName]
+	server.mu.RUnlock()
+	if svc == nil {
+		err = merr.New(merr.CodeNotFound, "rpc: can't find service "+req.ServiceMethod)
+		return
+	}
+	mtype = svc.methods[methodName]
+	if mtype == nil {
+		err = merr.New(merr.CodeNotFound, "rpc: can't find method "+req.ServiceMethod)
+	}
+	return
+}
+
+// sendResponse 写出响应，callErr不为nil时转换为结构化错误作为响应体
+func (server *server) sendResponse(sending *sync.Mutex, req *rpc.Request, reply interface{}, codec ServerCodec, callErr error) {
+	resp := &rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}
+	if callErr != nil {
+		e := merr.FromError(callErr)
+		resp.Error = e.Error()
+		reply = e
+	}
+	sending.Lock()
+	err := codec.WriteResponse(resp, reply)
+	if err != nil {
+		logger.Debug("rpc: writing response: %s", err)
+	}
+	sending.Unlock()
+}
+
+func (s *service) call(server *server, sending *sync.Mutex, wg *sync.WaitGroup, mtype *methodType, req *rpc.Request, argv, replyv reflect.Value, codec ServerCodec) {
+	defer wg.Done()
+
+	ctx := codec.Context(req.Seq)
+	call := &Call{
+		ServiceMethod: req.ServiceMethod,
+		Args:          argv.Interface(),
+		Reply:         replyv.Interface(),
+	}
+	if info, ok := CallInfoFromContext(ctx); ok {
+		call.RemoteAddr = info.RemoteAddr
+	}
+	call.Metadata, _ = metadata.FromIncomingContext(ctx)
+
+	core := func(ctx context.Context, call *Call) error {
+		in := []reflect.Value{s.rcvr}
+		if mtype.withCtx {
+			in = append(in, reflect.ValueOf(ctx))
+		}
+		in = append(in, argv, replyv)
+
+		returnValues := mtype.method.Func.Call(in)
+		if errInter := returnValues[0].Interface(); errInter != nil {
+			return errInter.(error)
+		}
+		return nil
+	}
+
+	var callErr error
+	func() {
+		// 方法或拦截器panic时作为错误返回给调用方，不影响同一链接上的其余请求
+		defer func() {
+			if e := recover(); e != nil {
+				logger.Error("recover: rpc method %s panic: %v", req.ServiceMethod, e)
+				callErr = merr.Newf(merr.CodeInternal, "rpc: method %s panic: %v", req.ServiceMethod, e)
+			}
+		}()
+
+		callErr = server.handler(core)(ctx, call)
+	}()
+
+	server.sendResponse(sending, req, replyv.Interface(), codec, callErr)
+}
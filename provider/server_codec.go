@@ -6,66 +6,78 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"net/http"
 	"net/rpc"
 	"sync"
 	"time"
 )
 
 import (
-	"github.com/ForeverSRC/morax/common/types"
+	merr "github.com/ForeverSRC/morax/error"
+	"github.com/ForeverSRC/morax/metadata"
 )
 
-var errMissingParams = errors.New("jsonrpc: request body missing params")
+var errMissingParams = merr.New(merr.CodeInvalidArgument, "jsonrpc: request body missing params")
+var errDeadlineExceeded = merr.New(merr.CodeTimeout, "rpc: caller deadline exceeded")
 
 type JsonServerCodec struct {
-	dec  *json.Decoder // for reading JSON values
-	enc  *json.Encoder // for writing JSON values
-	conn io.Closer
+	*codecConn
+	dec *json.Decoder // for reading JSON values
+	enc *json.Encoder // for writing JSON values
 
 	req serverRequest
+	// deadline 当前读取的请求的调用方deadline
+	deadline time.Time
 
 	mutex   sync.Mutex // protects seq, pending
 	seq     uint64
 	pending map[uint64]*json.RawMessage
-	isClose types.AtomicBool
-	server  *RpcProvider
 }
 
-func NewJsonServerCodec(conn io.ReadWriteCloser, p *RpcProvider) rpc.ServerCodec {
-	cd := &JsonServerCodec{
-		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
-		conn:    conn,
-		pending: make(map[uint64]*json.RawMessage),
-		server:  p,
+func NewJsonServerCodec(conn io.ReadWriteCloser, p *RpcProvider) ServerCodec {
+	return newJsonServerCodec(newCodecConn(conn, p), conn)
+}
+
+// newJsonServerCodec 从r读取请求，协商编解码器时r为带缓冲的链接
+func newJsonServerCodec(cc *codecConn, r io.Reader) *JsonServerCodec {
+	return &JsonServerCodec{
+		codecConn: cc,
+		dec:       json.NewDecoder(r),
+		enc:       json.NewEncoder(cc.conn),
+		pending:   make(map[uint64]*json.RawMessage),
 	}
-	cd.isClose.SetFalse()
-	p.TrackCodec(cd, true)
-	return cd
 }
 
 type serverRequest struct {
 	Method string           `json:"method"`
 	Params *json.RawMessage `json:"params"`
 	Id     *json.RawMessage `json:"id"`
+	// Timeout 调用方剩余的时间预算，单位毫秒
+	Timeout int64 `json:"timeout"`
+	// Meta 请求元数据
+	Meta metadata.MD `json:"meta"`
 }
 
 func (r *serverRequest) reset() {
 	r.Method = ""
 	r.Params = nil
 	r.Id = nil
+	r.Timeout = 0
+	r.Meta = nil
 }
 
 type serverResponse struct {
 	Id     *json.RawMessage `json:"id"`
 	Result interface{}      `json:"result"`
 	Error  interface{}      `json:"error"`
+	// Status 结构化错误，error仍为字符串，与jsonrpc客户端兼容
+	Status *merr.Error `json:"status,omitempty"`
+	// Meta 响应元数据
+	Meta metadata.MD `json:"meta,omitempty"`
 }
 
-// net/rpc 的 rpc.Server 首先调用ReadRequestHeader 将读取到的请求头部进行解码
-// 如果此方法返回错误，且为 io.EOF 或 io.ErrUnexpectedEOF 则返回，且不再读取req
-// 此时 rpc.Server 跳出循环，不再接受任何请求，等待其余请求结束后关闭codec
+// 方法分发器首先调用ReadRequestHeader 将读取到的请求头部进行解码
+// 如果此方法返回错误，则不再读取req
+// 此时分发器跳出循环，不再接受任何请求，等待其余请求结束后关闭codec
 func (c *JsonServerCodec) ReadRequestHeader(r *rpc.Request) error {
 	// 判断是否处于关闭状态
 	if c.isClose.IsSet() {
@@ -77,14 +89,16 @@ func (c *JsonServerCodec) ReadRequestHeader(r *rpc.Request) error {
 		return err
 	}
 	r.ServiceMethod = c.req.Method
+	c.deadline = deadlineOf(c.req.Timeout)
 
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 	c.seq++
 	c.pending[c.seq] = c.req.Id
 	c.req.Id = nil
 	r.Seq = c.seq
+	c.mutex.Unlock()
 
+	c.newRequest(r.Seq, r.ServiceMethod, c.req.Meta, c.deadline)
 	return nil
 }
 
@@ -97,13 +111,25 @@ func (c *JsonServerCodec) ReadRequestBody(x interface{}) error {
 	if x == nil {
 		return nil
 	}
+	// 调用方已放弃等待时不再执行方法，分发器将错误作为响应返回
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return errDeadlineExceeded
+	}
 	if c.req.Params == nil {
 		return errMissingParams
 	}
 
 	var params [1]interface{}
 	params[0] = x
-	return json.Unmarshal(*c.req.Params, &params)
+	if err := json.Unmarshal(*c.req.Params, &params); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	seq := c.seq
+	c.mutex.Unlock()
+	c.setContext(seq, x)
+	return nil
 }
 
 var null = json.RawMessage([]byte("null"))
@@ -124,41 +150,15 @@ func (c *JsonServerCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 		b = &null
 	}
 	resp := serverResponse{Id: b}
+	resp.Meta = c.finish(r.Seq)
 	if r.Error == "" {
 		resp.Result = x
 	} else {
 		resp.Error = r.Error
+		// 结构化错误写入status：{"code": "...", "message": "...", "details": {...}}
+		if e, ok := x.(*merr.Error); ok {
+			resp.Status = e
+		}
 	}
 	return c.enc.Encode(resp)
 }
-
-func (c *JsonServerCodec) Close() error {
-	if c.isClose.IsSet() {
-		return nil
-	}
-
-	c.isClose.SetTrue()
-	err := c.conn.Close()
-	c.server.TrackCodec(c, false)
-	return err
-}
-
-func (c *JsonServerCodec) closeIdle() (bool, error) {
-	if c.isClose.IsSet() {
-		return true, nil
-	}
-
-	st, unixSec := (c.conn).(*rpcConn).getState()
-
-	if st == http.StateNew && unixSec < time.Now().Unix()-5 {
-		st = http.StateIdle
-	}
-	if st != http.StateIdle || unixSec == 0 {
-		return false, nil
-	}
-	c.isClose.SetTrue()
-	err := c.conn.Close()
-	c.server.TrackCodec(c, false)
-	return true, err
-
-}
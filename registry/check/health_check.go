@@ -1,4 +1,4 @@
-package consul
+package check
 
 import (
 	"fmt"
@@ -10,15 +10,12 @@ import (
 	"github.com/ForeverSRC/morax/common/types"
 	ck "github.com/ForeverSRC/morax/config/check"
 	"github.com/ForeverSRC/morax/logger"
-)
-
-import (
-	consulapi "github.com/hashicorp/consul/api"
+	"github.com/ForeverSRC/morax/registry"
 )
 
 type HealthCheckService struct {
 	checkAddr string
-	CheckInfo *consulapi.AgentServiceCheck
+	CheckInfo *registry.Check
 	types.AbstractService
 }
 
@@ -27,13 +24,12 @@ func NewHealthCheckService(host string, ckf *ck.CheckConfig) *HealthCheckService
 		checkAddr: fmt.Sprintf("%s:%d", host, ckf.CheckPort),
 	}
 
-	check := new(consulapi.AgentServiceCheck)
-	check.TCP = hcs.checkAddr
-	check.Timeout = ckf.Timeout
-	check.Interval = ckf.Interval
-	check.DeregisterCriticalServiceAfter = ckf.DeregisterAfter // 故障检查失败30s后 consul自动将注册服务删除
-
-	hcs.CheckInfo = check
+	hcs.CheckInfo = &registry.Check{
+		TCP:             hcs.checkAddr,
+		Timeout:         ckf.Timeout,
+		Interval:        ckf.Interval,
+		DeregisterAfter: ckf.DeregisterAfter, // 故障检查失败一定时间后 注册中心自动将注册服务删除
+	}
 
 	hcs.InShutdown.SetFalse()
 	return hcs
@@ -7,23 +7,31 @@ import (
 )
 
 import (
+	"github.com/ForeverSRC/morax/common/constants"
 	cr "github.com/ForeverSRC/morax/config/registry"
 	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/registry"
 )
 
 import (
 	consulapi "github.com/hashicorp/consul/api"
 )
 
-type consulClientInfo struct {
+// ConsulRegistry 基于consul的注册中心实现
+type ConsulRegistry struct {
 	consulClient *consulapi.Client
 	httpClient   *http.Client
 }
 
-var clientInfo *consulClientInfo
+func init() {
+	registry.RegisterRegistry(constants.ConsulRegistry, NewRegistry)
+}
+
+func NewRegistry(rcf *cr.RegistryConfig) (registry.Registry, error) {
+	return NewClient(&rcf.ConsulClientConfig)
+}
 
-func NewClient(dcf *cr.ConsulClientConfig) {
-	var err error
+func NewClient(dcf *cr.ConsulClientConfig) (*ConsulRegistry, error) {
 	conf := consulapi.DefaultConfig()
 	conf.Address = dcf.Addr
 	if dcf.WaitTimeout == 0 {
@@ -34,13 +42,13 @@ func NewClient(dcf *cr.ConsulClientConfig) {
 
 	client, err := consulapi.NewClient(conf)
 	if err != nil {
-		logger.Fatal(err)
+		return nil, err
 	}
-	clientInfo = &consulClientInfo{consulClient: client, httpClient: conf.HttpClient}
+	return &ConsulRegistry{consulClient: client, httpClient: conf.HttpClient}, nil
 }
 
-func Register(registration *consulapi.AgentServiceRegistration) error {
-	err := clientInfo.consulClient.Agent().ServiceRegister(registration)
+func (r *ConsulRegistry) Register(ins *registry.Instance) error {
+	err := r.consulClient.Agent().ServiceRegister(genRegistration(ins))
 
 	if err != nil {
 		logger.Error("register error: %s", err)
@@ -51,17 +59,70 @@ func Register(registration *consulapi.AgentServiceRegistration) error {
 	return nil
 }
 
-func FindServers(ctx context.Context, name string, idx uint64) ([]*consulapi.ServiceEntry, *consulapi.QueryMeta, error) {
+func (r *ConsulRegistry) Watch(ctx context.Context, name string, idx uint64) ([]*registry.Instance, uint64, error) {
+	services, meta, err := r.FindServers(ctx, name, idx)
+	if err != nil {
+		return nil, idx, err
+	}
+
+	return toInstances(services), meta.LastIndex, nil
+}
+
+func (r *ConsulRegistry) List(name string) ([]*registry.Instance, error) {
+	services, _, err := r.consulClient.Health().Service(name, "", true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return toInstances(services), nil
+}
+
+func (r *ConsulRegistry) FindServers(ctx context.Context, name string, idx uint64) ([]*consulapi.ServiceEntry, *consulapi.QueryMeta, error) {
 	qo := &consulapi.QueryOptions{WaitIndex: idx}
 	qo = qo.WithContext(ctx)
 	// 阻塞
-	return clientInfo.consulClient.Health().Service(name, "", true, qo)
+	return r.consulClient.Health().Service(name, "", true, qo)
+}
+
+func (r *ConsulRegistry) Deregister(id string) error {
+	return r.consulClient.Agent().ServiceDeregister(id)
 }
 
-func Deregister(id string) error {
-	return clientInfo.consulClient.Agent().ServiceDeregister(id)
+// Close 关闭consul client idle connections
+func (r *ConsulRegistry) Close() {
+	r.httpClient.CloseIdleConnections()
 }
 
-func CloseIdleConn() {
-	clientInfo.httpClient.CloseIdleConnections()
+func genRegistration(ins *registry.Instance) *consulapi.AgentServiceRegistration {
+	registration := new(consulapi.AgentServiceRegistration)
+	registration.ID = ins.ID
+	registration.Name = ins.Name
+	registration.Port = ins.Port
+	registration.Address = ins.Host
+	registration.Tags = ins.Tags
+	registration.Meta = ins.Meta
+	if ins.Check != nil {
+		check := new(consulapi.AgentServiceCheck)
+		check.TCP = ins.Check.TCP
+		check.Timeout = ins.Check.Timeout
+		check.Interval = ins.Check.Interval
+		check.DeregisterCriticalServiceAfter = ins.Check.DeregisterAfter
+		registration.Check = check
+	}
+	return registration
+}
+
+func toInstances(services []*consulapi.ServiceEntry) []*registry.Instance {
+	res := make([]*registry.Instance, 0, len(services))
+	for _, s := range services {
+		res = append(res, &registry.Instance{
+			ID:   s.Service.ID,
+			Name: s.Service.Service,
+			Host: s.Service.Address,
+			Port: s.Service.Port,
+			Tags: s.Service.Tags,
+			Meta: s.Service.Meta,
+		})
+	}
+	return res
 }
@@ -0,0 +1,262 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	cr "github.com/ForeverSRC/morax/config/registry"
+	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/registry"
+)
+
+// EtcdRegistry 基于etcd语义的注册中心实现
+// 服务实例以"<prefix><service>/<id>"为键写入，并与租约关联，通过定时续约保持存活；
+// 实例进程退出后租约过期，实例自动从注册中心中移除，因此无需额外的健康检查服务
+type EtcdRegistry struct {
+	kv     KV
+	prefix string
+	ttl    int64
+	mu     sync.Mutex
+	// leases 实例ID->续约信息
+	leases map[string]*instanceLease
+}
+
+type instanceLease struct {
+	key    string
+	value  string
+	id     int64
+	cancel context.CancelFunc
+}
+
+// etcdInstance 注册中心中存储的实例格式
+type etcdInstance struct {
+	ID   string            `json:"id"`
+	Name string            `json:"name"`
+	Host string            `json:"host"`
+	Port int               `json:"port"`
+	Tags []string          `json:"tags,omitempty"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+func init() {
+	registry.RegisterRegistry(constants.EtcdRegistry, NewRegistry)
+}
+
+func NewRegistry(rcf *cr.RegistryConfig) (registry.Registry, error) {
+	kv, err := NewHttpKV(rcf.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEtcdRegistry(kv, rcf.Prefix, int64(rcf.TTL)), nil
+}
+
+func NewEtcdRegistry(kv KV, prefix string, ttl int64) *EtcdRegistry {
+	if prefix == "" {
+		prefix = constants.DefaultEtcdPrefix
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if ttl <= 0 {
+		ttl = constants.DefaultEtcdTTL
+	}
+
+	return &EtcdRegistry{
+		kv:     kv,
+		prefix: prefix,
+		ttl:    ttl,
+		leases: make(map[string]*instanceLease),
+	}
+}
+
+func (r *EtcdRegistry) Register(ins *registry.Instance) error {
+	if ins == nil || ins.ID == "" || ins.Name == "" {
+		return fmt.Errorf("invalid instance: id and name are required")
+	}
+
+	data, err := json.Marshal(&etcdInstance{
+		ID:   ins.ID,
+		Name: ins.Name,
+		Host: ins.Host,
+		Port: ins.Port,
+		Tags: ins.Tags,
+		Meta: ins.Meta,
+	})
+	if err != nil {
+		return err
+	}
+
+	il := &instanceLease{
+		key:   r.serviceKey(ins.Name) + ins.ID,
+		value: string(data),
+	}
+	if err = r.grantAndPut(il); err != nil {
+		logger.Error("register error: %s", err)
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	il.cancel = cancel
+
+	r.mu.Lock()
+	if old, ok := r.leases[ins.ID]; ok {
+		old.cancel()
+	}
+	r.leases[ins.ID] = il
+	r.mu.Unlock()
+
+	go r.keepAlive(ctx, il)
+
+	logger.Info("register service success!")
+	return nil
+}
+
+func (r *EtcdRegistry) Deregister(id string) error {
+	r.mu.Lock()
+	il, ok := r.leases[id]
+	delete(r.leases, id)
+	var lease int64
+	if ok {
+		lease = il.id
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("instance %s not registered", id)
+	}
+
+	il.cancel()
+	ctx, cancel := r.opContext()
+	defer cancel()
+	// 撤销租约，关联的实例键随之删除
+	return r.kv.Revoke(ctx, lease)
+}
+
+func (r *EtcdRegistry) Watch(ctx context.Context, name string, idx uint64) ([]*registry.Instance, uint64, error) {
+	prefix := r.serviceKey(name)
+	if idx > 0 {
+		// 阻塞
+		_, err := r.kv.Watch(ctx, prefix, int64(idx)+1)
+		if err != nil && !errors.Is(err, ErrCompacted) {
+			return nil, idx, err
+		}
+		// 已被压缩时直接读取全量实例
+	}
+
+	kvs, rev, err := r.kv.Range(ctx, prefix)
+	if err != nil {
+		return nil, idx, err
+	}
+	return toInstances(kvs), uint64(rev), nil
+}
+
+func (r *EtcdRegistry) List(name string) ([]*registry.Instance, error) {
+	ctx, cancel := r.opContext()
+	defer cancel()
+	kvs, _, err := r.kv.Range(ctx, r.serviceKey(name))
+	if err != nil {
+		return nil, err
+	}
+	return toInstances(kvs), nil
+}
+
+// Close 停止所有续约，租约过期后实例自动移除
+func (r *EtcdRegistry) Close() {
+	r.mu.Lock()
+	for id, il := range r.leases {
+		il.cancel()
+		delete(r.leases, id)
+	}
+	r.mu.Unlock()
+
+	_ = r.kv.Close()
+}
+
+func (r *EtcdRegistry) serviceKey(name string) string {
+	return r.prefix + name + "/"
+}
+
+func (r *EtcdRegistry) opContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(r.ttl)*time.Second)
+}
+
+func (r *EtcdRegistry) grantAndPut(il *instanceLease) error {
+	ctx, cancel := r.opContext()
+	defer cancel()
+
+	lease, err := r.kv.Grant(ctx, r.ttl)
+	if err != nil {
+		return err
+	}
+	if err = r.kv.Put(ctx, il.key, il.value, lease); err != nil {
+		_ = r.kv.Revoke(ctx, lease)
+		return err
+	}
+
+	r.mu.Lock()
+	il.id = lease
+	r.mu.Unlock()
+	return nil
+}
+
+// keepAlive 每ttl/3续约一次，租约已过期时重新注册实例
+func (r *EtcdRegistry) keepAlive(ctx context.Context, il *instanceLease) {
+	interval := time.Duration(r.ttl) * time.Second / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			lease := il.id
+			r.mu.Unlock()
+
+			opCtx, cancel := r.opContext()
+			err := r.kv.KeepAlive(opCtx, lease)
+			cancel()
+			if err == nil {
+				continue
+			}
+
+			logger.Warn("keep alive lease of %s error: %s", il.key, err)
+			if errors.Is(err, ErrLeaseNotFound) && ctx.Err() == nil {
+				if err = r.grantAndPut(il); err != nil {
+					logger.Error("re-register %s error: %s", il.key, err)
+				}
+			}
+		}
+	}
+}
+
+func toInstances(kvs []*KeyValue) []*registry.Instance {
+	res := make([]*registry.Instance, 0, len(kvs))
+	for _, kv := range kvs {
+		ei := &etcdInstance{}
+		if err := json.Unmarshal([]byte(kv.Value), ei); err != nil {
+			logger.Error("invalid instance of key %s: %s", kv.Key, err)
+			continue
+		}
+
+		res = append(res, &registry.Instance{
+			ID:   ei.ID,
+			Name: ei.Name,
+			Host: ei.Host,
+			Port: ei.Port,
+			Tags: ei.Tags,
+			Meta: ei.Meta,
+		})
+	}
+	return res
+}
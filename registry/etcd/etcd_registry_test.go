@@ -0,0 +1,68 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/registry"
+	"github.com/ForeverSRC/morax/registry/registrytest"
+)
+
+func TestEtcdRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registry.Registry {
+		r := NewEtcdRegistry(NewMemKV(), "", 0)
+		t.Cleanup(r.Close)
+		return r
+	})
+}
+
+// revokeLease 撤销实例的租约，模拟租约在etcd中过期
+func revokeLease(r *EtcdRegistry, kv *MemKV, id string) {
+	r.mu.Lock()
+	lease := r.leases[id].id
+	r.mu.Unlock()
+	_ = kv.Revoke(context.Background(), lease)
+}
+
+// newLeaseRegistry 创建ttl为1秒的注册中心并注册实例a，返回Watch的索引
+func newLeaseRegistry(t *testing.T) (*EtcdRegistry, *MemKV, uint64) {
+	kv := NewMemKV()
+	r := NewEtcdRegistry(kv, "", 1)
+	t.Cleanup(r.Close)
+	registrytest.Apply(t, r, []registrytest.Op{{Register: &registry.Instance{ID: "a", Name: "hello"}}})
+	idx := registrytest.ExpectWatch(t, r, "hello", 0, func() {}, []string{"a"})
+	return r, kv, idx
+}
+
+func TestEtcdRegistry_LeaseLost(t *testing.T) {
+	r, kv, idx := newLeaseRegistry(t)
+
+	// 租约失效时实例被移除，续约发现租约不存在后重新注册
+	registrytest.ExpectWatch(t, r, "hello", idx, func() { revokeLease(r, kv, "a") }, []string{})
+	registrytest.WaitFor(t, 2*time.Second, func() bool {
+		inss, _ := r.List("hello")
+		return len(inss) == 1
+	})
+}
+
+func TestEtcdRegistry_CloseExpires(t *testing.T) {
+	r, kv, _ := newLeaseRegistry(t)
+
+	// 停止续约后租约在ttl后过期，实例被移除
+	r.Close()
+	registrytest.WaitFor(t, 3*time.Second, func() bool {
+		kvs, _, _ := kv.Range(context.Background(), r.serviceKey("hello"))
+		return len(kvs) == 0
+	})
+}
+
+func TestEtcdRegistry_KeepAlive(t *testing.T) {
+	r, _, _ := newLeaseRegistry(t)
+
+	// 续约使实例在超过ttl后仍然存在
+	time.Sleep(1500 * time.Millisecond)
+	registrytest.ExpectList(t, r, "hello", []string{"a"})
+}
@@ -0,0 +1,300 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HttpKV 通过etcd v3的grpc-gateway(JSON over HTTP)接口访问etcd，不依赖etcd客户端
+type HttpKV struct {
+	endpoints []string
+	client    *http.Client
+	mu        sync.Mutex
+	// cur 当前可用的endpoint下标
+	cur int
+}
+
+func NewHttpKV(endpoints []string) (*HttpKV, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("etcd endpoints is empty")
+	}
+
+	eps := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		ep = strings.TrimRight(ep, "/")
+		if !strings.HasPrefix(ep, "http://") && !strings.HasPrefix(ep, "https://") {
+			ep = "http://" + ep
+		}
+		eps = append(eps, ep)
+	}
+
+	return &HttpKV{endpoints: eps, client: &http.Client{}}, nil
+}
+
+// int64Str grpc-gateway将int64编码为字符串
+type int64Str int64
+
+func (i *int64Str) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = int64Str(v)
+	return nil
+}
+
+type responseHeader struct {
+	Revision int64Str `json:"revision"`
+}
+
+type keyValue struct {
+	Key         string   `json:"key"`
+	Value       string   `json:"value"`
+	ModRevision int64Str `json:"mod_revision"`
+	Lease       int64Str `json:"lease"`
+}
+
+type gatewayError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (kv *HttpKV) Grant(ctx context.Context, ttl int64) (int64, error) {
+	var resp struct {
+		ID int64Str `json:"ID"`
+	}
+	err := kv.post(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": ttl}, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return int64(resp.ID), nil
+}
+
+func (kv *HttpKV) KeepAlive(ctx context.Context, lease int64) error {
+	var resp struct {
+		Result struct {
+			TTL int64Str `json:"TTL"`
+		} `json:"result"`
+	}
+	err := kv.post(ctx, "/v3/lease/keepalive", map[string]interface{}{"ID": lease}, &resp)
+	if err != nil {
+		return err
+	}
+	// 租约不存在时，返回的TTL不大于0
+	if resp.Result.TTL <= 0 {
+		return ErrLeaseNotFound
+	}
+	return nil
+}
+
+func (kv *HttpKV) Revoke(ctx context.Context, lease int64) error {
+	return kv.post(ctx, "/v3/lease/revoke", map[string]interface{}{"ID": lease}, nil)
+}
+
+func (kv *HttpKV) Put(ctx context.Context, key, value string, lease int64) error {
+	req := map[string]interface{}{
+		"key":   encode(key),
+		"value": encode(value),
+	}
+	if lease != 0 {
+		req["lease"] = lease
+	}
+	return kv.post(ctx, "/v3/kv/put", req, nil)
+}
+
+func (kv *HttpKV) Range(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	var resp struct {
+		Header responseHeader `json:"header"`
+		Kvs    []keyValue     `json:"kvs"`
+	}
+	req := map[string]interface{}{
+		"key":       encode(prefix),
+		"range_end": encode(prefixRangeEnd(prefix)),
+	}
+	err := kv.post(ctx, "/v3/kv/range", req, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]*KeyValue, 0, len(resp.Kvs))
+	for _, v := range resp.Kvs {
+		res = append(res, &KeyValue{
+			Key:         decode(v.Key),
+			Value:       decode(v.Value),
+			ModRevision: int64(v.ModRevision),
+			Lease:       int64(v.Lease),
+		})
+	}
+	return res, int64(resp.Header.Revision), nil
+}
+
+func (kv *HttpKV) Watch(ctx context.Context, prefix string, rev int64) (int64, error) {
+	req := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            encode(prefix),
+			"range_end":      encode(prefixRangeEnd(prefix)),
+			"start_revision": rev,
+		},
+	}
+
+	// 连接在ctx取消或返回时关闭，服务端随之取消watch
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	body, err := kv.do(ctx, "/v3/watch", req)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var resp struct {
+			Result struct {
+				Header          responseHeader `json:"header"`
+				CompactRevision int64Str       `json:"compact_revision"`
+				Canceled        bool           `json:"canceled"`
+				Events          []struct {
+					Kv keyValue `json:"kv"`
+				} `json:"events"`
+			} `json:"result"`
+			Error *gatewayError `json:"error"`
+		}
+
+		// 阻塞
+		if err = dec.Decode(&resp); err != nil {
+			return 0, err
+		}
+		if resp.Error != nil {
+			return 0, resp.Error.toError()
+		}
+
+		result := resp.Result
+		if result.CompactRevision != 0 {
+			return 0, ErrCompacted
+		}
+		if result.Canceled {
+			return 0, fmt.Errorf("etcd: watch canceled")
+		}
+		if len(result.Events) > 0 {
+			return int64(result.Events[0].Kv.ModRevision), nil
+		}
+	}
+}
+
+func (kv *HttpKV) Close() error {
+	kv.client.CloseIdleConnections()
+	return nil
+}
+
+func (kv *HttpKV) post(ctx context.Context, path string, req interface{}, resp interface{}) error {
+	body, err := kv.do(ctx, path, req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if resp == nil {
+		_, _ = io.Copy(io.Discard, body)
+		return nil
+	}
+	return json.NewDecoder(body).Decode(resp)
+}
+
+// do 依次尝试各个endpoint，直至请求成功发出
+func (kv *HttpKV) do(ctx context.Context, path string, req interface{}) (io.ReadCloser, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	kv.mu.Lock()
+	cur := kv.cur
+	kv.mu.Unlock()
+
+	var lastErr error
+	for i := 0; i < len(kv.endpoints); i++ {
+		idx := (cur + i) % len(kv.endpoints)
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, kv.endpoints[idx]+path, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		httpResp, err := kv.client.Do(httpReq)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		kv.mu.Lock()
+		kv.cur = idx
+		kv.mu.Unlock()
+
+		if httpResp.StatusCode != http.StatusOK {
+			defer httpResp.Body.Close()
+			ge := &gatewayError{}
+			if err = json.NewDecoder(httpResp.Body).Decode(ge); err != nil {
+				return nil, fmt.Errorf("etcd: unexpected status %s", httpResp.Status)
+			}
+			return nil, ge.toError()
+		}
+		return httpResp.Body, nil
+	}
+
+	return nil, lastErr
+}
+
+func (ge *gatewayError) toError() error {
+	msg := ge.Message
+	if msg == "" {
+		msg = ge.Error
+	}
+	if strings.Contains(msg, "lease not found") {
+		return ErrLeaseNotFound
+	}
+	if strings.Contains(msg, "compacted") {
+		return ErrCompacted
+	}
+	return fmt.Errorf("etcd: %s", msg)
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func decode(s string) string {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// prefixRangeEnd 前缀查询的range_end，为前缀最后一个不为0xff的字节加1
+func prefixRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i] = end[i] + 1
+			return string(end[:i+1])
+		}
+	}
+	// 前缀全为0xff时，查询所有大于等于key的键
+	return "\x00"
+}
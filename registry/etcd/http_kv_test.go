@@ -0,0 +1,462 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// header etcd v3 grpc-gateway响应中的header，int64字段编码为字符串
+const header = `"header":{"cluster_id":"14841639068965178418","member_id":"10276657743932975437","revision":"12","raft_term":"2"}`
+
+// gatewayReply 回放的一次响应，lines为流式响应的各行，hold为true时写完后保持链接直至客户端断开
+type gatewayReply struct {
+	status int
+	lines  []string
+	hold   bool
+}
+
+// gateway 回放etcd v3 grpc-gateway响应的测试服务，记录收到的请求
+type gateway struct {
+	*httptest.Server
+	mu      sync.Mutex
+	replies map[string]gatewayReply
+	reqs    map[string][]map[string]interface{}
+}
+
+func newGateway(t *testing.T, replies map[string]gatewayReply) *gateway {
+	g := &gateway{
+		replies: replies,
+		reqs:    make(map[string][]map[string]interface{}),
+	}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *gateway) serve(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	g.mu.Lock()
+	g.reqs[r.URL.Path] = append(g.reqs[r.URL.Path], req)
+	reply, ok := g.replies[r.URL.Path]
+	g.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if reply.status != 0 {
+		w.WriteHeader(reply.status)
+	}
+	for _, line := range reply.lines {
+		_, _ = io.WriteString(w, line+"\n")
+		w.(http.Flusher).Flush()
+	}
+	if reply.hold {
+		<-r.Context().Done()
+	}
+}
+
+// requests 返回path收到的请求
+func (g *gateway) requests(path string) []map[string]interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reqs[path]
+}
+
+func newTestKV(t *testing.T, endpoints ...string) *HttpKV {
+	kv, err := NewHttpKV(endpoints)
+	if err != nil {
+		t.Fatalf("NewHttpKV() error = %v", err)
+	}
+	return kv
+}
+
+func TestNewHttpKV(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "empty", wantErr: true},
+		{name: "host port", endpoints: []string{"127.0.0.1:2379"}, want: []string{"http://127.0.0.1:2379"}},
+		{name: "scheme and trailing slash", endpoints: []string{"https://etcd-0:2379/", "http://etcd-1:2379"}, want: []string{"https://etcd-0:2379", "http://etcd-1:2379"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv, err := NewHttpKV(tt.endpoints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHttpKV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(kv.endpoints, tt.want) {
+				t.Errorf("NewHttpKV() endpoints = %v, want %v", kv.endpoints, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpKV_Grant(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   gatewayReply
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:  "granted",
+			reply: gatewayReply{lines: []string{`{` + header + `,"ID":"7587861831553367048","TTL":"10"}`}},
+			want:  7587861831553367048,
+		},
+		{
+			name:    "too many requests",
+			reply:   gatewayReply{status: http.StatusTooManyRequests, lines: []string{`{"error":"etcdserver: too many requests","code":14,"message":"etcdserver: too many requests"}`}},
+			wantErr: true,
+		},
+		{
+			name:    "non json error",
+			reply:   gatewayReply{status: http.StatusBadGateway, lines: []string{"bad gateway"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, map[string]gatewayReply{"/v3/lease/grant": tt.reply})
+			got, err := newTestKV(t, g.URL).Grant(context.Background(), 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Grant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Grant() = %d, want %d", got, tt.want)
+			}
+			if req := g.requests("/v3/lease/grant")[0]; req["TTL"] != float64(10) {
+				t.Errorf("Grant() request = %v", req)
+			}
+		})
+	}
+}
+
+func TestHttpKV_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply gatewayReply
+		want  error
+	}{
+		{
+			name:  "alive",
+			reply: gatewayReply{lines: []string{`{"result":{` + header + `,"ID":"7587861831553367048","TTL":"10"}}`}},
+		},
+		{
+			// 租约不存在时etcd返回的TTL为0，grpc-gateway省略值为0的字段
+			name:  "lease not found omits ttl",
+			reply: gatewayReply{lines: []string{`{"result":{` + header + `,"ID":"7587861831553367048"}}`}},
+			want:  ErrLeaseNotFound,
+		},
+		{
+			name:  "lease not found negative ttl",
+			reply: gatewayReply{lines: []string{`{"result":{` + header + `,"ID":"7587861831553367048","TTL":"-1"}}`}},
+			want:  ErrLeaseNotFound,
+		},
+		{
+			name:  "lease not found error",
+			reply: gatewayReply{status: http.StatusNotFound, lines: []string{`{"error":"etcdserver: requested lease not found","code":5,"message":"etcdserver: requested lease not found"}`}},
+			want:  ErrLeaseNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, map[string]gatewayReply{"/v3/lease/keepalive": tt.reply})
+			err := newTestKV(t, g.URL).KeepAlive(context.Background(), 7587861831553367048)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("KeepAlive() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpKV_Revoke(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply gatewayReply
+		want  error
+	}{
+		{
+			name:  "revoked",
+			reply: gatewayReply{lines: []string{`{` + header + `}`}},
+		},
+		{
+			name:  "lease not found",
+			reply: gatewayReply{status: http.StatusNotFound, lines: []string{`{"error":"etcdserver: requested lease not found","code":5,"message":"etcdserver: requested lease not found"}`}},
+			want:  ErrLeaseNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, map[string]gatewayReply{"/v3/lease/revoke": tt.reply})
+			err := newTestKV(t, g.URL).Revoke(context.Background(), 1)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Revoke() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpKV_Put(t *testing.T) {
+	tests := []struct {
+		name  string
+		lease int64
+		want  map[string]interface{}
+	}{
+		{
+			name: "without lease",
+			want: map[string]interface{}{"key": "L21vcmF4L2hlbGxvL2E=", "value": "eyJpZCI6ImEifQ=="},
+		},
+		{
+			name:  "with lease",
+			lease: 7587861831553367048,
+			want:  map[string]interface{}{"key": "L21vcmF4L2hlbGxvL2E=", "value": "eyJpZCI6ImEifQ==", "lease": float64(7587861831553367048)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, map[string]gatewayReply{"/v3/kv/put": {lines: []string{`{` + header + `}`}}})
+			if err := newTestKV(t, g.URL).Put(context.Background(), "/morax/hello/a", `{"id":"a"}`, tt.lease); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if got := g.requests("/v3/kv/put")[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Put() request = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpKV_Range(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   gatewayReply
+		want    []*KeyValue
+		wantRev int64
+		wantErr bool
+	}{
+		{
+			name: "kvs",
+			reply: gatewayReply{lines: []string{`{` + header + `,"kvs":[` +
+				`{"key":"L21vcmF4L2hlbGxvL2E=","create_revision":"5","mod_revision":"7","version":"2","value":"eyJpZCI6ImEifQ==","lease":"7587861831553367048"},` +
+				`{"key":"L21vcmF4L2hlbGxvL2I=","create_revision":"9","mod_revision":"9","version":"1","value":"eyJpZCI6ImIifQ=="}` +
+				`],"count":"2"}`}},
+			want: []*KeyValue{
+				{Key: "/morax/hello/a", Value: `{"id":"a"}`, ModRevision: 7, Lease: 7587861831553367048},
+				{Key: "/morax/hello/b", Value: `{"id":"b"}`, ModRevision: 9},
+			},
+			wantRev: 12,
+		},
+		{
+			// 没有键时grpc-gateway省略kvs与count
+			name:    "empty",
+			reply:   gatewayReply{lines: []string{`{` + header + `}`}},
+			want:    []*KeyValue{},
+			wantRev: 12,
+		},
+		{
+			name:    "unavailable",
+			reply:   gatewayReply{status: http.StatusServiceUnavailable, lines: []string{`{"error":"etcdserver: leader changed","code":14,"message":"etcdserver: leader changed"}`}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, map[string]gatewayReply{"/v3/kv/range": tt.reply})
+			got, rev, err := newTestKV(t, g.URL).Range(context.Background(), "/morax/hello/")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Range() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) || rev != tt.wantRev {
+				t.Errorf("Range() = %v, %d, want %v, %d", got, rev, tt.want, tt.wantRev)
+			}
+
+			// range_end为前缀最后一个字节加1："/morax/hello/" -> "/morax/hello0"
+			want := map[string]interface{}{"key": "L21vcmF4L2hlbGxvLw==", "range_end": "L21vcmF4L2hlbGxvMA=="}
+			if req := g.requests("/v3/kv/range")[0]; !reflect.DeepEqual(req, want) {
+				t.Errorf("Range() request = %v, want %v", req, want)
+			}
+		})
+	}
+}
+
+func TestHttpKV_Watch(t *testing.T) {
+	const created = `{"result":{` + header + `,"created":true}}`
+
+	tests := []struct {
+		name    string
+		reply   gatewayReply
+		want    int64
+		wantErr error
+	}{
+		{
+			name: "put event",
+			reply: gatewayReply{lines: []string{
+				created,
+				`{"result":{` + header + `,"events":[{"kv":{"key":"L21vcmF4L2hlbGxvL2E=","create_revision":"13","mod_revision":"13","version":"1","value":"eyJpZCI6ImEifQ==","lease":"7587861831553367048"}}]}}`,
+			}, hold: true},
+			want: 13,
+		},
+		{
+			name: "delete event",
+			reply: gatewayReply{lines: []string{
+				created,
+				`{"result":{` + header + `,"events":[{"type":"DELETE","kv":{"key":"L21vcmF4L2hlbGxvL2E=","mod_revision":"14"}}]}}`,
+			}, hold: true},
+			want: 14,
+		},
+		{
+			name: "progress notify before event",
+			reply: gatewayReply{lines: []string{
+				created,
+				`{"result":{` + header + `}}`,
+				`{"result":{` + header + `,"events":[{"kv":{"key":"L21vcmF4L2hlbGxvL2I=","mod_revision":"15"}},{"kv":{"key":"L21vcmF4L2hlbGxvL2M=","mod_revision":"15"}}]}}`,
+			}, hold: true},
+			want: 15,
+		},
+		{
+			name: "compacted",
+			reply: gatewayReply{lines: []string{
+				`{"result":{` + header + `,"created":true,"canceled":true,"compact_revision":"10","cancel_reason":"mvcc: required revision has been compacted"}}`,
+			}, hold: true},
+			wantErr: ErrCompacted,
+		},
+		{
+			name: "stream error compacted",
+			reply: gatewayReply{lines: []string{
+				created,
+				`{"error":{"grpc_code":11,"http_code":400,"message":"etcdserver: mvcc: required revision has been compacted","http_status":"Bad Request"}}`,
+			}},
+			wantErr: ErrCompacted,
+		},
+		{
+			name: "canceled",
+			reply: gatewayReply{lines: []string{
+				created,
+				`{"result":{` + header + `,"canceled":true,"cancel_reason":"etcdserver: no leader"}}`,
+			}, hold: true},
+			wantErr: errors.New("etcd: watch canceled"),
+		},
+		{
+			name:    "stream closed",
+			reply:   gatewayReply{lines: []string{created}},
+			wantErr: io.EOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, map[string]gatewayReply{"/v3/watch": tt.reply})
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			got, err := newTestKV(t, g.URL).Watch(ctx, "/morax/hello/", 13)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Watch() error = %v", err)
+			case tt.wantErr != nil && (err == nil || !errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error()):
+				t.Fatalf("Watch() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Watch() = %d, want %d", got, tt.want)
+			}
+
+			want := map[string]interface{}{"create_request": map[string]interface{}{
+				"key":            "L21vcmF4L2hlbGxvLw==",
+				"range_end":      "L21vcmF4L2hlbGxvMA==",
+				"start_revision": float64(13),
+			}}
+			if req := g.requests("/v3/watch")[0]; !reflect.DeepEqual(req, want) {
+				t.Errorf("Watch() request = %v, want %v", req, want)
+			}
+		})
+	}
+}
+
+func TestHttpKV_WatchCancel(t *testing.T) {
+	g := newGateway(t, map[string]gatewayReply{"/v3/watch": {
+		lines: []string{`{"result":{` + header + `,"created":true}}`},
+		hold:  true,
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newTestKV(t, g.URL).Watch(ctx, "/morax/hello/", 13)
+	if err == nil || ctx.Err() == nil {
+		t.Errorf("Watch() error = %v, want returned after ctx done", err)
+	}
+}
+
+func TestHttpKV_Failover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	g := newGateway(t, map[string]gatewayReply{"/v3/kv/put": {lines: []string{`{` + header + `}`}}})
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		wantCur   int
+		wantErr   bool
+	}{
+		{name: "first available", endpoints: []string{g.URL, down.URL}, wantCur: 0},
+		{name: "fail over to next", endpoints: []string{down.URL, g.URL}, wantCur: 1},
+		{name: "all down", endpoints: []string{down.URL, down.URL}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := newTestKV(t, tt.endpoints...)
+			for i := 0; i < 2; i++ {
+				err := kv.Put(context.Background(), "k", "v", 0)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Put() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+			if kv.cur != tt.wantCur {
+				t.Errorf("current endpoint = %d, want %d", kv.cur, tt.wantCur)
+			}
+		})
+	}
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "/morax/hello/", want: "/morax/hello0"},
+		{prefix: "a", want: "b"},
+		{prefix: "a\xff", want: "b"},
+		{prefix: "\xff\xff", want: "\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.ToValidUTF8(tt.prefix, "?"), func(t *testing.T) {
+			if got := prefixRangeEnd(tt.prefix); got != tt.want {
+				t.Errorf("prefixRangeEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrCompacted 监听的起始revision已被压缩
+var ErrCompacted = errors.New("etcd: required revision has been compacted")
+
+// ErrLeaseNotFound 租约不存在或已过期
+var ErrLeaseNotFound = errors.New("etcd: requested lease not found")
+
+// KeyValue 键值对
+type KeyValue struct {
+	Key         string
+	Value       string
+	ModRevision int64
+	Lease       int64
+}
+
+// KV etcd v3语义的键值存储，注册中心仅依赖以下操作
+type KV interface {
+	// Grant 创建租约，ttl单位为秒
+	Grant(ctx context.Context, ttl int64) (int64, error)
+	// KeepAlive 续约一次，租约不存在时返回ErrLeaseNotFound
+	KeepAlive(ctx context.Context, lease int64) error
+	// Revoke 撤销租约，租约关联的键一并删除
+	Revoke(ctx context.Context, lease int64) error
+	// Put 写入键值，lease不为0时将键与租约关联
+	Put(ctx context.Context, key, value string, lease int64) error
+	// Range 返回前缀下的所有键值及当前revision
+	Range(ctx context.Context, prefix string) ([]*KeyValue, int64, error)
+	// Watch 阻塞直至前缀下出现revision不小于rev的变更，返回该变更的revision
+	Watch(ctx context.Context, prefix string, rev int64) (int64, error)
+	// Close 释放资源
+	Close() error
+}
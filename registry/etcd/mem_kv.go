@@ -0,0 +1,184 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemKV 进程内的etcd替身，实现租约过期、前缀监听及revision语义，用于测试
+type MemKV struct {
+	mu  sync.Mutex
+	rev int64
+	// kvs 当前存在的键值
+	kvs map[string]*KeyValue
+	// modRevs 键最近一次变更（含删除）的revision
+	modRevs   map[string]int64
+	leases    map[int64]*memLease
+	nextLease int64
+	// changed 每次变更时关闭并替换，用于唤醒阻塞的Watch
+	changed chan struct{}
+}
+
+type memLease struct {
+	ttl   time.Duration
+	timer *time.Timer
+	keys  map[string]struct{}
+}
+
+func NewMemKV() *MemKV {
+	return &MemKV{
+		rev:     1,
+		kvs:     make(map[string]*KeyValue),
+		modRevs: make(map[string]int64),
+		leases:  make(map[int64]*memLease),
+		changed: make(chan struct{}),
+	}
+}
+
+func (m *MemKV) Grant(ctx context.Context, ttl int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextLease++
+	id := m.nextLease
+	l := &memLease{
+		ttl:  time.Duration(ttl) * time.Second,
+		keys: make(map[string]struct{}),
+	}
+	l.timer = time.AfterFunc(l.ttl, func() {
+		m.expire(id)
+	})
+	m.leases[id] = l
+	return id, nil
+}
+
+func (m *MemKV) KeepAlive(ctx context.Context, lease int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.leases[lease]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+	l.timer.Reset(l.ttl)
+	return nil
+}
+
+func (m *MemKV) Revoke(ctx context.Context, lease int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.leases[lease]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+	l.timer.Stop()
+	m.revokeLocked(lease)
+	return nil
+}
+
+func (m *MemKV) Put(ctx context.Context, key, value string, lease int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lease != 0 {
+		l, ok := m.leases[lease]
+		if !ok {
+			return ErrLeaseNotFound
+		}
+		l.keys[key] = struct{}{}
+	}
+
+	// 键原先关联的租约不再持有该键
+	if old, ok := m.kvs[key]; ok && old.Lease != 0 && old.Lease != lease {
+		if l, ok := m.leases[old.Lease]; ok {
+			delete(l.keys, key)
+		}
+	}
+
+	m.rev++
+	m.kvs[key] = &KeyValue{Key: key, Value: value, ModRevision: m.rev, Lease: lease}
+	m.modRevs[key] = m.rev
+	m.notifyLocked()
+	return nil
+}
+
+func (m *MemKV) Range(ctx context.Context, prefix string) ([]*KeyValue, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]*KeyValue, 0)
+	for k, v := range m.kvs {
+		if strings.HasPrefix(k, prefix) {
+			cp := *v
+			res = append(res, &cp)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res, m.rev, nil
+}
+
+func (m *MemKV) Watch(ctx context.Context, prefix string, rev int64) (int64, error) {
+	for {
+		m.mu.Lock()
+		var found int64
+		for k, r := range m.modRevs {
+			if r >= rev && strings.HasPrefix(k, prefix) && (found == 0 || r < found) {
+				found = r
+			}
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		if found != 0 {
+			return found, nil
+		}
+
+		// 阻塞
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (m *MemKV) Close() error {
+	return nil
+}
+
+func (m *MemKV) expire(lease int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revokeLocked(lease)
+}
+
+func (m *MemKV) revokeLocked(lease int64) {
+	l, ok := m.leases[lease]
+	if !ok {
+		return
+	}
+	delete(m.leases, lease)
+
+	if len(l.keys) == 0 {
+		return
+	}
+
+	// 同一租约关联的键在同一revision中删除
+	m.rev++
+	for k := range l.keys {
+		delete(m.kvs, k)
+		m.modRevs[k] = m.rev
+	}
+	m.notifyLocked()
+}
+
+func (m *MemKV) notifyLocked() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
@@ -0,0 +1,388 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	cr "github.com/ForeverSRC/morax/config/registry"
+	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/registry"
+	"github.com/ForeverSRC/morax/registry/memory"
+)
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+// FileRegistry 基于本地文件的注册中心实现
+// path为文件时，文件中存储全部服务实例的列表，注册与注销时持有同目录下"<path>.lock"的文件锁，多个进程可以共用；
+// path为目录时，目录下每个.json/.yaml/.yml文件存储一个或多个服务实例，新注册的实例以"<转义后的id>.json"写入，
+// 已存在于某个文件中的实例在该文件中更新或移除
+// 文件变化时重新加载全部实例，由内存注册中心负责索引与唤醒Watch
+type FileRegistry struct {
+	path  string
+	isDir bool
+	// mu 保护对文件的写入及sources
+	mu sync.Mutex
+	// sources 目录模式下实例ID->所在的文件
+	sources map[string]string
+	store   *memory.MemoryRegistry
+	watcher *fsnotify.Watcher
+}
+
+// fileInstance 文件中的服务实例格式
+type fileInstance struct {
+	ID   string            `json:"id" yaml:"id"`
+	Name string            `json:"name" yaml:"name"`
+	Host string            `json:"host" yaml:"host"`
+	Port int               `json:"port" yaml:"port"`
+	Tags []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Meta map[string]string `json:"meta,omitempty" yaml:"meta,omitempty"`
+}
+
+func init() {
+	registry.RegisterRegistry(constants.FileRegistry, NewRegistry)
+}
+
+func NewRegistry(rcf *cr.RegistryConfig) (registry.Registry, error) {
+	return NewFileRegistry(rcf.Path)
+}
+
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file registry path is blank")
+	}
+
+	r := &FileRegistry{
+		path:    filepath.Clean(path),
+		sources: make(map[string]string),
+		store:   memory.NewRegistry(),
+	}
+
+	watchDir := filepath.Dir(r.path)
+	if fi, err := os.Stat(r.path); err == nil && fi.IsDir() {
+		r.isDir = true
+		watchDir = r.path
+	} else if err = os.MkdirAll(watchDir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// 监听所在目录，以便感知文件被替换、删除后重建等情况
+	if err = watcher.Add(watchDir); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	r.watcher = watcher
+
+	go r.watchFiles()
+	return r, nil
+}
+
+func (r *FileRegistry) Register(ins *registry.Instance) error {
+	if ins == nil || ins.ID == "" || ins.Name == "" {
+		return fmt.Errorf("invalid instance: id and name are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, unlock, err := r.sourceFileLocked(ins.ID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inss, err := readInstances(name)
+	if err != nil {
+		return err
+	}
+
+	res := make([]*registry.Instance, 0, len(inss)+1)
+	for _, v := range inss {
+		if v.ID != ins.ID {
+			res = append(res, v)
+		}
+	}
+	res = append(res, ins)
+	if err = writeInstances(name, res); err != nil {
+		return err
+	}
+
+	logger.Info("register service success!")
+	return r.reloadLocked()
+}
+
+func (r *FileRegistry) Deregister(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, unlock, err := r.sourceFileLocked(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inss, err := readInstances(name)
+	if err != nil {
+		return err
+	}
+
+	res := make([]*registry.Instance, 0, len(inss))
+	for _, v := range inss {
+		if v.ID != id {
+			res = append(res, v)
+		}
+	}
+	if len(res) == len(inss) {
+		return fmt.Errorf("instance %s not found", id)
+	}
+
+	// 目录模式下文件中没有其他实例时删除文件
+	if r.isDir && len(res) == 0 {
+		err = os.Remove(name)
+	} else {
+		err = writeInstances(name, res)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.reloadLocked()
+}
+
+// sourceFileLocked 返回实例所在的文件，需要时持有文件锁，unlock释放文件锁
+// 单文件模式下为path；目录模式下重新加载后查找实例所在的文件，不存在时为新实例的文件
+func (r *FileRegistry) sourceFileLocked(id string) (string, func(), error) {
+	if !r.isDir {
+		unlock, err := lockFile(r.path + ".lock")
+		if err != nil {
+			return "", nil, err
+		}
+		return r.path, unlock, nil
+	}
+
+	// 其他进程写入的文件可能尚未重新加载
+	if err := r.reloadLocked(); err != nil {
+		return "", nil, err
+	}
+	if name, ok := r.sources[id]; ok {
+		return name, func() {}, nil
+	}
+	return r.instanceFile(id), func() {}, nil
+}
+
+func (r *FileRegistry) Watch(ctx context.Context, name string, idx uint64) ([]*registry.Instance, uint64, error) {
+	return r.store.Watch(ctx, name, idx)
+}
+
+func (r *FileRegistry) List(name string) ([]*registry.Instance, error) {
+	return r.store.List(name)
+}
+
+// Close 停止监听文件变化
+func (r *FileRegistry) Close() {
+	_ = r.watcher.Close()
+}
+
+func (r *FileRegistry) watchFiles() {
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if !r.isDir && filepath.Clean(event.Name) != r.path {
+				continue
+			}
+			if r.isDir && !isInstanceFile(event.Name) {
+				continue
+			}
+
+			logger.Debug("registry file changed: %s", event)
+			if err := r.reload(); err != nil {
+				logger.Error("reload registry file error: %s", err)
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error("watch registry file error: %s", err)
+		}
+	}
+}
+
+func (r *FileRegistry) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked()
+}
+
+func (r *FileRegistry) reloadLocked() error {
+	var inss []*registry.Instance
+	sources := make(map[string]string)
+	if r.isDir {
+		files, err := ioutil.ReadDir(r.path)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if f.IsDir() || !isInstanceFile(f.Name()) {
+				continue
+			}
+
+			name := filepath.Join(r.path, f.Name())
+			res, err := readInstances(name)
+			if err != nil {
+				// 单个文件格式错误不影响其余实例
+				logger.Error("read registry file %s error: %s", f.Name(), err)
+				continue
+			}
+			for _, ins := range res {
+				sources[ins.ID] = name
+			}
+			inss = append(inss, res...)
+		}
+	} else {
+		res, err := readInstances(r.path)
+		if err != nil {
+			return err
+		}
+		inss = res
+	}
+
+	r.sources = sources
+	r.store.Replace(inss)
+	return nil
+}
+
+// instanceFile 目录模式下新实例的文件名，id中字母、数字、"-"、"."以外的字节（含"_"）转义为"_"加两位十六进制
+// 如"127.0.0.1:20000"写入"127.0.0.1_3a20000.json"；转义保证不同的id对应不同的文件名，大写字母同样转义，适用于不区分大小写的文件系统
+func (r *FileRegistry) instanceFile(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return filepath.Join(r.path, b.String()+".json")
+}
+
+func isInstanceFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+func isYaml(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readInstances 读取文件中的实例，文件不存在时返回空列表
+// 文件内容可以是实例列表，也可以是单个实例
+func readInstances(name string) ([]*registry.Instance, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+
+	unmarshal := json.Unmarshal
+	if isYaml(name) {
+		unmarshal = yaml.Unmarshal
+	}
+
+	var fis []fileInstance
+	if err = unmarshal(data, &fis); err != nil {
+		var fi fileInstance
+		if e := unmarshal(data, &fi); e != nil {
+			return nil, fmt.Errorf("parse %s error: %s", name, err)
+		}
+		fis = []fileInstance{fi}
+	}
+
+	res := make([]*registry.Instance, 0, len(fis))
+	for _, fi := range fis {
+		res = append(res, fi.toInstance())
+	}
+	return res, nil
+}
+
+// writeInstances 先写入临时文件再重命名，避免监听方读到不完整的内容
+func writeInstances(name string, inss []*registry.Instance) error {
+	fis := make([]fileInstance, 0, len(inss))
+	for _, ins := range inss {
+		fis = append(fis, newFileInstance(ins))
+	}
+
+	var data []byte
+	var err error
+	if isYaml(name) {
+		data, err = yaml.Marshal(fis)
+	} else {
+		data, err = json.MarshalIndent(fis, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func newFileInstance(ins *registry.Instance) fileInstance {
+	return fileInstance{
+		ID:   ins.ID,
+		Name: ins.Name,
+		Host: ins.Host,
+		Port: ins.Port,
+		Tags: ins.Tags,
+		Meta: ins.Meta,
+	}
+}
+
+func (fi *fileInstance) toInstance() *registry.Instance {
+	return &registry.Instance{
+		ID:   fi.ID,
+		Name: fi.Name,
+		Host: fi.Host,
+		Port: fi.Port,
+		Tags: fi.Tags,
+		Meta: fi.Meta,
+	}
+}
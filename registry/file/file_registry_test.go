@@ -0,0 +1,282 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+import (
+	"github.com/ForeverSRC/morax/registry"
+	"github.com/ForeverSRC/morax/registry/registrytest"
+)
+
+func newTestRegistry(t *testing.T, path string) *FileRegistry {
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("NewFileRegistry() error = %v", err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+// writeFiles 在目录下写入文件 文件名->内容
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listFiles 返回目录下的实例文件名
+func listFiles(t *testing.T, dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if isInstanceFile(fi.Name()) {
+			res = append(res, fi.Name())
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestFileRegistry(t *testing.T) {
+	tests := []struct {
+		name string
+		path func(dir string) string
+	}{
+		{name: "json file", path: func(dir string) string { return filepath.Join(dir, "registry.json") }},
+		{name: "yaml file", path: func(dir string) string { return filepath.Join(dir, "registry.yaml") }},
+		{name: "directory", path: func(dir string) string { return dir }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registrytest.Run(t, func(t *testing.T) registry.Registry {
+				return newTestRegistry(t, tt.path(t.TempDir()))
+			})
+		})
+	}
+}
+
+func TestFileRegistry_instanceFile(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "hello-1", want: "hello-1.json"},
+		{id: "127.0.0.1:20000", want: "127.0.0.1_3a20000.json"},
+		{id: "svc-a:8080", want: "svc-a_3a8080.json"},
+		{id: "svc-a_8080", want: "svc-a_5f8080.json"},
+		{id: "Svc", want: "_53vc.json"},
+		{id: "../etc/passwd", want: ".._2fetc_2fpasswd.json"},
+		{id: "服务", want: "_e6_9c_8d_e5_8a_a1.json"},
+	}
+
+	r := &FileRegistry{path: "registry"}
+	seen := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got := r.instanceFile(tt.id)
+			if want := filepath.Join("registry", tt.want); got != want {
+				t.Errorf("instanceFile(%q) = %q, want %q", tt.id, got, want)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("instanceFile(%q) = instanceFile(%q) = %q", tt.id, other, got)
+			}
+			seen[got] = tt.id
+		})
+	}
+}
+
+func TestFileRegistry_Dir(t *testing.T) {
+	tests := []struct {
+		name string
+		// files 注册中心创建前目录中已有的文件
+		files     map[string]string
+		ops       []registrytest.Op
+		want      []string
+		wantFiles []string
+	}{
+		{
+			name: "colliding ids",
+			ops: []registrytest.Op{
+				{Register: &registry.Instance{ID: "svc-a:8080", Name: "hello"}},
+				{Register: &registry.Instance{ID: "svc-a_8080", Name: "hello"}},
+			},
+			want:      []string{"svc-a:8080", "svc-a_8080"},
+			wantFiles: []string{"svc-a_3a8080.json", "svc-a_5f8080.json"},
+		},
+		{
+			name: "deregister one of colliding ids",
+			ops: []registrytest.Op{
+				{Register: &registry.Instance{ID: "svc-a:8080", Name: "hello"}},
+				{Register: &registry.Instance{ID: "svc-a_8080", Name: "hello"}},
+				{Deregister: "svc-a:8080"},
+			},
+			want:      []string{"svc-a_8080"},
+			wantFiles: []string{"svc-a_5f8080.json"},
+		},
+		{
+			name:  "deregister from user file",
+			files: map[string]string{"hello.yaml": "id: hello-1\nname: hello\nhost: 127.0.0.1\nport: 20000\n"},
+			ops: []registrytest.Op{
+				{Deregister: "hello-1"},
+			},
+			want:      []string{},
+			wantFiles: []string{},
+		},
+		{
+			name: "deregister from user list",
+			files: map[string]string{"hello.json": `[
+				{"id": "a", "name": "hello", "host": "127.0.0.1", "port": 20000},
+				{"id": "b", "name": "hello", "host": "127.0.0.1", "port": 20001}
+			]`},
+			ops: []registrytest.Op{
+				{Deregister: "a"},
+			},
+			want:      []string{"b"},
+			wantFiles: []string{"hello.json"},
+		},
+		{
+			name: "deregister unknown",
+			ops: []registrytest.Op{
+				{Register: &registry.Instance{ID: "a", Name: "hello"}},
+				{Deregister: "b", WantErr: true},
+			},
+			want:      []string{"a"},
+			wantFiles: []string{"a.json"},
+		},
+		{
+			name:  "invalid file skipped",
+			files: map[string]string{"bad.json": "{"},
+			ops: []registrytest.Op{
+				{Register: &registry.Instance{ID: "a", Name: "hello"}},
+			},
+			want:      []string{"a"},
+			wantFiles: []string{"a.json", "bad.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			r := newTestRegistry(t, dir)
+
+			registrytest.Apply(t, r, tt.ops)
+			registrytest.ExpectList(t, r, "hello", tt.want)
+			if got := listFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestFileRegistry_Update(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"hello.yml": "- id: a\n  name: hello\n  port: 20000\n"})
+	r := newTestRegistry(t, dir)
+
+	if err := r.Register(&registry.Instance{ID: "a", Name: "hello", Port: 20001}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	inss, err := readInstances(filepath.Join(dir, "hello.yml"))
+	if err != nil {
+		t.Fatalf("readInstances() error = %v", err)
+	}
+	if len(inss) != 1 || inss[0].Port != 20001 {
+		t.Errorf("hello.yml = %+v, want instance a with port 20001", inss)
+	}
+	// 已存在于文件中的实例在原文件中更新，不写入新文件
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, []string{"hello.yml"}) {
+		t.Errorf("files = %v, want [hello.yml]", got)
+	}
+}
+
+func TestFileRegistry_ExternalChange(t *testing.T) {
+	tests := []struct {
+		name string
+		path func(dir string) string
+		// change 其他进程对文件的修改
+		change func(t *testing.T, path string)
+		want   []string
+	}{
+		{
+			name: "file replaced",
+			path: func(dir string) string { return filepath.Join(dir, "registry.json") },
+			change: func(t *testing.T, path string) {
+				if err := writeInstances(path, []*registry.Instance{{ID: "a", Name: "hello"}, {ID: "b", Name: "hello"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "file added to directory",
+			path: func(dir string) string { return dir },
+			change: func(t *testing.T, path string) {
+				writeFiles(t, path, map[string]string{"b.yaml": "id: b\nname: hello\n"})
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "file removed from directory",
+			path: func(dir string) string { return dir },
+			change: func(t *testing.T, path string) {
+				if err := os.Remove(filepath.Join(path, "a.json")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path(t.TempDir())
+			r := newTestRegistry(t, path)
+			registrytest.Apply(t, r, []registrytest.Op{{Register: &registry.Instance{ID: "a", Name: "hello"}}})
+
+			idx := registrytest.ExpectWatch(t, r, "hello", 0, func() {}, []string{"a"})
+			registrytest.ExpectWatch(t, r, "hello", idx, func() { tt.change(t, path) }, tt.want)
+		})
+	}
+}
+
+func TestFileRegistry_SharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	const n = 8
+
+	// 多个进程共用同一个文件时，文件锁保证注册不互相覆盖
+	wg := new(sync.WaitGroup)
+	for i := 0; i < n; i++ {
+		r := newTestRegistry(t, path)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := r.Register(&registry.Instance{ID: fmt.Sprintf("hello-%d", i), Name: "hello"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	inss, err := readInstances(path)
+	if err != nil {
+		t.Fatalf("readInstances() error = %v", err)
+	}
+	if len(inss) != n {
+		t.Errorf("instances = %v, want %d instances", registrytest.IDs(inss), n)
+	}
+}
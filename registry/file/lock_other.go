@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package file
+
+// lockFile 当前平台不支持文件锁，仅依赖进程内的互斥锁，多个进程共用单个文件时应使用目录模式
+func lockFile(name string) (func(), error) {
+	return func() {}, nil
+}
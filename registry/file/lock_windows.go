@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"os"
+)
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// lockFile 通过LockFileEx对name加排他锁，阻塞直至获得锁，返回释放锁的函数
+func lockFile(name string) (func(), error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	h := windows.Handle(f.Fd())
+	if err = windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{}); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = windows.UnlockFileEx(h, 0, 1, 0, &windows.Overlapped{})
+		_ = f.Close()
+	}, nil
+}
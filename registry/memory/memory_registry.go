@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	cr "github.com/ForeverSRC/morax/config/registry"
+	"github.com/ForeverSRC/morax/registry"
+)
+
+// MemoryRegistry 进程内的注册中心实现，用于测试及单进程部署
+// 索引语义与consul阻塞查询一致：Watch传入上一次返回的索引，直至服务实例发生变化才返回
+type MemoryRegistry struct {
+	mu sync.Mutex
+	// index 全局递增的修改索引
+	index uint64
+	// services 服务名->实例ID->实例
+	services map[string]map[string]*registry.Instance
+	// indexes 服务名->该服务最近一次修改时的索引
+	indexes map[string]uint64
+	// names 实例ID->服务名
+	names map[string]string
+	// changed 每次修改时关闭并替换，用于唤醒阻塞的Watch
+	changed chan struct{}
+}
+
+// defaultRegistry 通过配置创建的内存注册中心在进程内共享，使同一进程中的provider和consumer可以互相发现
+var defaultRegistry = NewRegistry()
+
+func init() {
+	registry.RegisterRegistry(constants.MemoryRegistry, func(rcf *cr.RegistryConfig) (registry.Registry, error) {
+		return defaultRegistry, nil
+	})
+}
+
+func NewRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		index:    1,
+		services: make(map[string]map[string]*registry.Instance),
+		indexes:  make(map[string]uint64),
+		names:    make(map[string]string),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (r *MemoryRegistry) Register(ins *registry.Instance) error {
+	if ins == nil || ins.ID == "" || ins.Name == "" {
+		return fmt.Errorf("invalid instance: id and name are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 同一ID以不同服务名重复注册时，先从原服务中移除
+	if old, ok := r.names[ins.ID]; ok && old != ins.Name {
+		r.removeLocked(ins.ID)
+	}
+
+	inss, ok := r.services[ins.Name]
+	if !ok {
+		inss = make(map[string]*registry.Instance)
+		r.services[ins.Name] = inss
+	}
+
+	cp := *ins
+	inss[ins.ID] = &cp
+	r.names[ins.ID] = ins.Name
+	r.notifyLocked(ins.Name)
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[id]; !ok {
+		return fmt.Errorf("instance %s not found", id)
+	}
+
+	r.removeLocked(id)
+	return nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, name string, idx uint64) ([]*registry.Instance, uint64, error) {
+	for {
+		r.mu.Lock()
+		cur := r.serviceIndexLocked(name)
+		if cur > idx {
+			res := r.listLocked(name)
+			r.mu.Unlock()
+			return res, cur, nil
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		// 阻塞
+		select {
+		case <-ctx.Done():
+			return nil, idx, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (r *MemoryRegistry) List(name string) ([]*registry.Instance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.listLocked(name), nil
+}
+
+// Replace 以给定的实例整体替换注册中心中的内容，仅实例发生变化的服务会唤醒阻塞的Watch
+func (r *MemoryRegistry) Replace(inss []*registry.Instance) {
+	services := make(map[string]map[string]*registry.Instance)
+	names := make(map[string]string)
+	for _, ins := range inss {
+		if ins == nil || ins.ID == "" || ins.Name == "" {
+			continue
+		}
+
+		m, ok := services[ins.Name]
+		if !ok {
+			m = make(map[string]*registry.Instance)
+			services[ins.Name] = m
+		}
+		cp := *ins
+		m[ins.ID] = &cp
+		names[ins.ID] = ins.Name
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := make(map[string]struct{})
+	for name, m := range services {
+		if !reflect.DeepEqual(m, r.services[name]) {
+			changed[name] = struct{}{}
+		}
+	}
+	for name := range r.services {
+		if _, ok := services[name]; !ok {
+			changed[name] = struct{}{}
+		}
+	}
+
+	r.services = services
+	r.names = names
+	for name := range changed {
+		r.notifyLocked(name)
+	}
+}
+
+// Close 内存注册中心无需释放资源
+func (r *MemoryRegistry) Close() {
+}
+
+func (r *MemoryRegistry) removeLocked(id string) {
+	name := r.names[id]
+	delete(r.names, id)
+	delete(r.services[name], id)
+	if len(r.services[name]) == 0 {
+		delete(r.services, name)
+	}
+	r.notifyLocked(name)
+}
+
+func (r *MemoryRegistry) notifyLocked(name string) {
+	r.index++
+	r.indexes[name] = r.index
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// serviceIndexLocked 未发生过修改的服务索引为1，与consul一致，索引永不为0
+func (r *MemoryRegistry) serviceIndexLocked(name string) uint64 {
+	if idx, ok := r.indexes[name]; ok {
+		return idx
+	}
+	return 1
+}
+
+func (r *MemoryRegistry) listLocked(name string) []*registry.Instance {
+	inss := r.services[name]
+	res := make([]*registry.Instance, 0, len(inss))
+	for _, ins := range inss {
+		cp := *ins
+		res = append(res, &cp)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
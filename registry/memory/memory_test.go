@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/ForeverSRC/morax/registry"
+	"github.com/ForeverSRC/morax/registry/registrytest"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registry.Registry {
+		return NewRegistry()
+	})
+}
+
+func TestMemoryRegistry_Rename(t *testing.T) {
+	r := NewRegistry()
+	registrytest.Apply(t, r, []registrytest.Op{
+		{Register: &registry.Instance{ID: "a", Name: "hello"}},
+		{Register: &registry.Instance{ID: "a", Name: "other"}},
+	})
+
+	// 同一ID以不同服务名重复注册时，从原服务中移除
+	registrytest.ExpectList(t, r, "hello", []string{})
+	registrytest.ExpectList(t, r, "other", []string{"a"})
+}
+
+func TestMemoryRegistry_Replace(t *testing.T) {
+	tests := []struct {
+		name string
+		inss []*registry.Instance
+		// wake Watch是否被唤醒
+		wake bool
+		want []string
+	}{
+		{
+			name: "add",
+			inss: []*registry.Instance{{ID: "a", Name: "hello"}, {ID: "b", Name: "hello"}},
+			wake: true,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "remove service",
+			inss: nil,
+			wake: true,
+			want: []string{},
+		},
+		{
+			name: "unchanged",
+			inss: []*registry.Instance{{ID: "a", Name: "hello"}, {ID: "x", Name: "other"}},
+		},
+		{
+			name: "invalid instances skipped",
+			inss: []*registry.Instance{{ID: "a", Name: "hello"}, {ID: "", Name: "hello"}, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			registrytest.Apply(t, r, []registrytest.Op{{Register: &registry.Instance{ID: "a", Name: "hello"}}})
+			idx := registrytest.ExpectWatch(t, r, "hello", 0, func() {}, []string{"a"})
+
+			if tt.wake {
+				registrytest.ExpectWatch(t, r, "hello", idx, func() { r.Replace(tt.inss) }, tt.want)
+				return
+			}
+
+			// 服务的实例未变化时不唤醒Watch
+			r.Replace(tt.inss)
+			registrytest.ExpectWatch(t, r, "hello", idx, func() {
+				_ = r.Register(&registry.Instance{ID: "c", Name: "hello"})
+			}, []string{"a", "c"})
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+)
+
+import (
+	"github.com/ForeverSRC/morax/common/constants"
+	cr "github.com/ForeverSRC/morax/config/registry"
+)
+
+// Instance 注册中心中的服务实例
+type Instance struct {
+	ID   string
+	Name string
+	Host string
+	Port int
+	Tags []string
+	Meta map[string]string
+	// Check 健康检查信息，不需要健康检查的注册中心可忽略
+	Check *Check
+}
+
+// Check tcp模式的健康检查信息
+type Check struct {
+	TCP             string
+	Timeout         string
+	Interval        string
+	DeregisterAfter string
+}
+
+// Registry 注册中心
+type Registry interface {
+	// Register 注册服务实例
+	Register(ins *Instance) error
+	// Deregister 注销服务实例
+	Deregister(id string) error
+	// Watch 阻塞直至服务实例相对于idx发生变化或ctx取消，返回当前健康实例及新的索引
+	Watch(ctx context.Context, name string, idx uint64) ([]*Instance, uint64, error)
+	// List 返回服务当前的健康实例
+	List(name string) ([]*Instance, error)
+	// Close 释放注册中心客户端占用的资源
+	Close()
+}
+
+// Factory 根据配置创建注册中心
+type Factory func(rcf *cr.RegistryConfig) (Registry, error)
+
+var factories = make(map[string]Factory)
+
+func RegisterRegistry(registryType string, f Factory) {
+	factories[registryType] = f
+}
+
+func NewRegistry(rcf *cr.RegistryConfig) (Registry, error) {
+	registryType := rcf.Type
+	if registryType == "" {
+		registryType = constants.DefaultRegistry
+	}
+
+	f, ok := factories[registryType]
+	if !ok {
+		return nil, fmt.Errorf("un found registry type:%s", registryType)
+	}
+
+	return f(rcf)
+}
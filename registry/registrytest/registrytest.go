@@ -0,0 +1,278 @@
+package registrytest
+
+// 注册中心实现的通用测试，各实现在自己的测试中调用Run，实现特有的行为在各自的测试中补充
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/ForeverSRC/morax/registry"
+)
+
+// Factory 为每个子测试创建一个空的注册中心
+type Factory func(t *testing.T) registry.Registry
+
+// Run 运行所有通用测试
+func Run(t *testing.T, newRegistry Factory) {
+	t.Run("RegisterDeregister", func(t *testing.T) { testRegisterDeregister(t, newRegistry) })
+	t.Run("Instance", func(t *testing.T) { testInstance(t, newRegistry) })
+	t.Run("Watch", func(t *testing.T) { testWatch(t, newRegistry) })
+	t.Run("WatchCancel", func(t *testing.T) { testWatchCancel(t, newRegistry) })
+}
+
+// IDs 返回实例ID列表
+func IDs(inss []*registry.Instance) []string {
+	res := make([]string, 0, len(inss))
+	for _, ins := range inss {
+		res = append(res, ins.ID)
+	}
+	return res
+}
+
+// WaitFor 轮询直至cond返回true，超过timeout时测试失败
+func WaitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in %s", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Op 对注册中心的一次注册或注销
+type Op struct {
+	Register   *registry.Instance
+	Deregister string
+	WantErr    bool
+}
+
+// Apply 依次执行ops，结果与预期不符时测试失败
+func Apply(t *testing.T, r registry.Registry, ops []Op) {
+	t.Helper()
+	for _, o := range ops {
+		var err error
+		if o.Register != nil {
+			err = r.Register(o.Register)
+		} else {
+			err = r.Deregister(o.Deregister)
+		}
+		if (err != nil) != o.WantErr {
+			t.Fatalf("op %+v error = %v, wantErr %v", o, err, o.WantErr)
+		}
+	}
+}
+
+// ExpectList 服务当前的实例ID与want不符时测试失败
+func ExpectList(t *testing.T, r registry.Registry, name string, want []string) {
+	t.Helper()
+	inss, err := r.List(name)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := IDs(inss); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+}
+
+func testRegisterDeregister(t *testing.T, newRegistry Factory) {
+	tests := []struct {
+		name    string
+		ops     []Op
+		service string
+		want    []string
+	}{
+		{
+			name:    "empty",
+			service: "hello",
+			want:    []string{},
+		},
+		{
+			name: "register sorted by id",
+			ops: []Op{
+				{Register: &registry.Instance{ID: "b", Name: "hello", Host: "127.0.0.1", Port: 8081}},
+				{Register: &registry.Instance{ID: "a", Name: "hello", Host: "127.0.0.1", Port: 8080}},
+				{Register: &registry.Instance{ID: "c", Name: "other"}},
+			},
+			service: "hello",
+			want:    []string{"a", "b"},
+		},
+		{
+			name: "service name is not a prefix of another",
+			ops: []Op{
+				{Register: &registry.Instance{ID: "a", Name: "hello"}},
+				{Register: &registry.Instance{ID: "b", Name: "hello2"}},
+			},
+			service: "hello",
+			want:    []string{"a"},
+		},
+		{
+			name: "register twice",
+			ops: []Op{
+				{Register: &registry.Instance{ID: "a", Name: "hello", Port: 8080}},
+				{Register: &registry.Instance{ID: "a", Name: "hello", Port: 8081}},
+			},
+			service: "hello",
+			want:    []string{"a"},
+		},
+		{
+			name: "deregister",
+			ops: []Op{
+				{Register: &registry.Instance{ID: "a", Name: "hello"}},
+				{Register: &registry.Instance{ID: "b", Name: "hello"}},
+				{Deregister: "a"},
+			},
+			service: "hello",
+			want:    []string{"b"},
+		},
+		{
+			name: "deregister unknown",
+			ops: []Op{
+				{Register: &registry.Instance{ID: "a", Name: "hello"}},
+				{Deregister: "x", WantErr: true},
+			},
+			service: "hello",
+			want:    []string{"a"},
+		},
+		{
+			name: "invalid instance",
+			ops: []Op{
+				{Register: &registry.Instance{ID: "", Name: "hello"}, WantErr: true},
+				{Register: &registry.Instance{ID: "a", Name: ""}, WantErr: true},
+			},
+			service: "hello",
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistry(t)
+			Apply(t, r, tt.ops)
+			ExpectList(t, r, tt.service, tt.want)
+		})
+	}
+}
+
+func testInstance(t *testing.T, newRegistry Factory) {
+	r := newRegistry(t)
+	ins := &registry.Instance{
+		ID:   "hello-1",
+		Name: "hello",
+		Host: "127.0.0.1",
+		Port: 8080,
+		Tags: []string{"v1"},
+		Meta: map[string]string{"protocols": "morax,stream"},
+	}
+	if err := r.Register(ins); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	inss, err := r.List("hello")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(inss) != 1 || !reflect.DeepEqual(inss[0], ins) {
+		t.Errorf("List() = %+v, want %+v", inss, ins)
+	}
+}
+
+func testWatch(t *testing.T, newRegistry Factory) {
+	tests := []struct {
+		name string
+		// change 在Watch阻塞后对注册中心的修改
+		change []Op
+		want   []string
+	}{
+		{
+			name:   "register",
+			change: []Op{{Register: &registry.Instance{ID: "b", Name: "hello"}}},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "deregister",
+			change: []Op{{Deregister: "a"}},
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRegistry(t)
+			Apply(t, r, []Op{{Register: &registry.Instance{ID: "a", Name: "hello"}}})
+			idx := ExpectWatch(t, r, "hello", 0, func() {}, []string{"a"})
+
+			// 其他服务的修改不唤醒Watch
+			ExpectWatch(t, r, "hello", idx, func() {
+				Apply(t, r, []Op{{Register: &registry.Instance{ID: "x", Name: "other"}}})
+				time.Sleep(50 * time.Millisecond)
+				Apply(t, r, tt.change)
+			}, tt.want)
+		})
+	}
+}
+
+func testWatchCancel(t *testing.T, newRegistry Factory) {
+	r := newRegistry(t)
+	_, idx, err := r.Watch(context.Background(), "hello", 0)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, next, err := r.Watch(ctx, "hello", idx)
+	if err == nil {
+		t.Errorf("Watch() error = nil, want error after ctx done")
+	}
+	if next != idx {
+		t.Errorf("Watch() index = %d, want %d", next, idx)
+	}
+}
+
+// ExpectWatch 以idx开始Watch，确认Watch在change前不返回、在change后返回want，返回新的索引
+// idx为0时Watch立即返回，不检查是否阻塞
+func ExpectWatch(t *testing.T, r registry.Registry, name string, idx uint64, change func(), want []string) uint64 {
+	t.Helper()
+	type result struct {
+		inss []*registry.Instance
+		idx  uint64
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		inss, next, err := r.Watch(context.Background(), name, idx)
+		ch <- result{inss, next, err}
+	}()
+
+	if idx != 0 {
+		select {
+		case res := <-ch:
+			t.Fatalf("Watch() returned before change: %v", IDs(res.inss))
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	change()
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			t.Fatalf("Watch() error = %v", res.err)
+		}
+		if res.idx <= idx {
+			t.Errorf("Watch() index = %d, want > %d", res.idx, idx)
+		}
+		if got := IDs(res.inss); !reflect.DeepEqual(got, want) {
+			t.Errorf("Watch() = %v, want %v", got, want)
+		}
+		return res.idx
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() not woken by change")
+	}
+	return 0
+}
@@ -2,23 +2,26 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
 import (
+	"github.com/ForeverSRC/morax/common/constants"
 	"github.com/ForeverSRC/morax/common/utils"
 	ck "github.com/ForeverSRC/morax/config/check"
 	cc "github.com/ForeverSRC/morax/config/consumer"
 	cp "github.com/ForeverSRC/morax/config/provider"
+	cr "github.com/ForeverSRC/morax/config/registry"
 	cs "github.com/ForeverSRC/morax/config/service"
 	"github.com/ForeverSRC/morax/consumer"
+	"github.com/ForeverSRC/morax/logger"
+	"github.com/ForeverSRC/morax/metadata"
 	"github.com/ForeverSRC/morax/provider"
-	"github.com/ForeverSRC/morax/registry/consul"
-)
-
-import (
-	consulapi "github.com/hashicorp/consul/api"
+	"github.com/ForeverSRC/morax/registry"
+	"github.com/ForeverSRC/morax/registry/check"
 )
 
 const DEFAULT_SERVICE_PORT = 8888
@@ -27,7 +30,8 @@ type MoraxService struct {
 	MoraxServiceBase
 	pro   *provider.RpcProvider
 	con   *consumer.RpcConsumer
-	check *consul.HealthCheckService
+	check *check.HealthCheckService
+	reg   registry.Registry
 }
 
 type MoraxServiceBase struct {
@@ -35,6 +39,10 @@ type MoraxServiceBase struct {
 	host    string
 	id      string
 	rpcPort int
+	version string
+	group   string
+	tags    []string
+	meta    map[string]string
 	ctx     context.Context
 }
 
@@ -53,6 +61,10 @@ func (ms *MoraxService) InitService(sf *cs.ServiceConfig, ctx context.Context) e
 		ms.host = sf.Host
 	}
 	ms.rpcPort = DEFAULT_SERVICE_PORT
+	ms.version = sf.Version
+	ms.group = sf.Group
+	ms.tags = sf.Tags
+	ms.meta = sf.Meta
 	ms.ctx = ctx
 	return nil
 }
@@ -62,15 +74,34 @@ func (ms *MoraxService) generateId() string {
 	return ms.id
 }
 
+// InitRegistry 根据配置初始化注册中心
+func (ms *MoraxService) InitRegistry(rcf *cr.RegistryConfig) error {
+	reg, err := registry.NewRegistry(rcf)
+	if err != nil {
+		return err
+	}
+
+	ms.reg = reg
+	return nil
+}
+
+// SetRegistry 使用自定义的注册中心实现
+func (ms *MoraxService) SetRegistry(reg registry.Registry) {
+	ms.reg = reg
+}
+
 // InitHealthCheck 初始化健康检查服务
 func (ms *MoraxService) InitHealthCheck(ckf *ck.CheckConfig) {
-	healthCheck := consul.NewHealthCheckService(ms.host, ckf)
+	healthCheck := check.NewHealthCheckService(ms.host, ckf)
 	ms.check = healthCheck
 }
 
-// InitRpcConsumer 初始化rpc consumer
+// InitRpcConsumer 初始化rpc consumer，需在注册中心初始化之后调用
 func (ms *MoraxService) InitRpcConsumer(cmf *cc.ConsumerConfig) {
-	con := consumer.NewRpcConsumer(ms.ctx, cmf)
+	con := consumer.NewRpcConsumer(ms.ctx, cmf, ms.reg)
+	if ms.name != "" {
+		con.SetConnMetadata(metadata.Pairs(constants.ConnMetaCaller, ms.name))
+	}
 	ms.con = con
 }
 
@@ -103,19 +134,95 @@ func (ms *MoraxService) RegisterConsumer(name string, service interface{}) error
 	return ms.con.RegisterConsumer(name, service)
 }
 
+// RegisterFallback 注册降级处理函数，见consumer.RpcConsumer.RegisterFallback
+func (ms *MoraxService) RegisterFallback(providerName, methodName string, fb consumer.Fallback) error {
+	if ms.con == nil {
+		return fmt.Errorf("consumer is not initialized")
+	}
+
+	ms.con.RegisterFallback(providerName, methodName, fb)
+	return nil
+}
+
+// AddInterceptor 添加对所有提供者生效的消费拦截器
+func (ms *MoraxService) AddInterceptor(i consumer.Interceptor) error {
+	if ms.con == nil {
+		return fmt.Errorf("consumer is not initialized")
+	}
+
+	ms.con.AddInterceptor(i)
+	return nil
+}
+
+// AddProviderInterceptor 添加对指定提供者生效的消费拦截器
+func (ms *MoraxService) AddProviderInterceptor(providerName string, i consumer.Interceptor) error {
+	if ms.con == nil {
+		return fmt.Errorf("consumer is not initialized")
+	}
+
+	ms.con.AddProviderInterceptor(providerName, i)
+	return nil
+}
+
+// AddServerInterceptor 添加提供方法的拦截器
+func (ms *MoraxService) AddServerInterceptor(i provider.Interceptor) error {
+	if ms.pro == nil {
+		return fmt.Errorf("provider is not initialized")
+	}
+
+	ms.pro.AddInterceptor(i)
+	return nil
+}
+
+// Invoke 泛化调用，见consumer.RpcConsumer.Invoke
+func (ms *MoraxService) Invoke(ctx context.Context, providerName, methodName string, args interface{}, reply interface{}) error {
+	if ms.con == nil {
+		return fmt.Errorf("consumer is not initialized")
+	}
+
+	return ms.con.Invoke(ctx, providerName, methodName, args, reply)
+}
+
+// InvokeRaw 以JSON格式的参数进行泛化调用，见consumer.RpcConsumer.InvokeRaw
+func (ms *MoraxService) InvokeRaw(ctx context.Context, providerName, methodName string, args json.RawMessage) (json.RawMessage, error) {
+	if ms.con == nil {
+		return nil, fmt.Errorf("consumer is not initialized")
+	}
+
+	return ms.con.InvokeRaw(ctx, providerName, methodName, args)
+}
+
 // ListenAndServe 启动服务
+// 仅作为消费者且订阅的提供者均配置了直连地址时不依赖注册中心，注册失败时继续启动
 func (ms *MoraxService) ListenAndServe() error {
-	// 启动健康检查服务
-	if ms.check == nil {
-		return fmt.Errorf("health check service is not initialized")
+	needRegistry := ms.pro != nil || ms.con == nil || !ms.con.StaticOnly()
+	if ms.reg == nil && needRegistry {
+		return fmt.Errorf("registry is not initialized")
+	}
+
+	// 启动健康检查服务（如果有）
+	if ms.check != nil {
+		ms.check.ListenAndServe()
+	}
+
+	// 启动provider（如果有），在注册前完成监听，保证实例被发现时即可接受链接
+	if ms.pro != nil {
+		err := ms.pro.ListenAndServe()
+		if err != nil {
+			return err
+		}
 	}
-	ms.check.ListenAndServe()
 
 	// 注册服务
-	registration := ms.genRegistration()
-	err := consul.Register(registration)
-	if err != nil {
-		return err
+	if ms.reg != nil {
+		registration := ms.genRegistration()
+		err := ms.reg.Register(registration)
+		if err != nil && needRegistry {
+			return err
+		}
+		if err != nil {
+			logger.Warn("register service %s error: %s, consume static providers only", ms.name, err)
+		}
 	}
 
 	// 启动consumer watcher（如果有）
@@ -123,30 +230,52 @@ func (ms *MoraxService) ListenAndServe() error {
 		ms.con.StartWatch()
 	}
 
-	// 启动provider（如果有）
-	if ms.pro != nil {
-		ms.pro.ListenAndServe()
-	}
-
 	return nil
 }
 
-func (ms *MoraxService) genRegistration() *consulapi.AgentServiceRegistration {
-	registration := new(consulapi.AgentServiceRegistration)
+func (ms *MoraxService) genRegistration() *registry.Instance {
+	registration := new(registry.Instance)
 	registration.ID = ms.generateId()
 	registration.Name = ms.name
 	registration.Port = ms.rpcPort
-	registration.Address = ms.host
-	registration.Check = ms.check.CheckInfo
+	registration.Host = ms.host
+	registration.Tags = ms.tags
+	registration.Meta = ms.genMeta()
+	if ms.check != nil {
+		registration.Check = ms.check.CheckInfo
+	}
 	return registration
 }
 
+// genMeta 将版本、分组与支持的编解码器写入元数据
+func (ms *MoraxService) genMeta() map[string]string {
+	meta := make(map[string]string, len(ms.meta)+2)
+	for k, v := range ms.meta {
+		meta[k] = v
+	}
+	if ms.version != "" {
+		meta[constants.MetaVersion] = ms.version
+	}
+	if ms.group != "" {
+		meta[constants.MetaGroup] = ms.group
+	}
+	if ms.pro != nil {
+		meta[constants.MetaCodecs] = strings.Join(ms.pro.Codecs(), ",")
+		meta[constants.MetaProtocols] = strings.Join([]string{constants.ProtocolMorax, constants.ProtocolStream}, ",")
+	}
+	return meta
+}
+
 func (ms *MoraxService) Shutdown(ctx context.Context) error {
 	// 向注册中心注销实例
-	_ = consul.Deregister(ms.id)
+	if ms.reg != nil {
+		_ = ms.reg.Deregister(ms.id)
+	}
 
-	// 健康检查关机
-	_ = ms.check.Shutdown()
+	// 健康检查关机（如果有）
+	if ms.check != nil {
+		_ = ms.check.Shutdown()
+	}
 
 	// 消费者优雅关机（如果有）
 	if ms.con != nil {
@@ -157,8 +286,10 @@ func (ms *MoraxService) Shutdown(ctx context.Context) error {
 	if ms.pro != nil {
 		_ = ms.pro.Shutdown()
 	}
-	// 关闭consul client idle connections
-	consul.CloseIdleConn()
+	// 释放注册中心客户端资源
+	if ms.reg != nil {
+		ms.reg.Close()
+	}
 
 	pollIntervalBase := time.Millisecond
 	timer := time.NewTimer(utils.NextPollInterval(&pollIntervalBase))
@@ -172,6 +303,8 @@ func (ms *MoraxService) Shutdown(ctx context.Context) error {
 
 		select {
 		case <-ctx.Done():
+			// 等待超时，取消仍在执行的请求
+			ms.pro.CancelRequests()
 			return ctx.Err()
 		case <-timer.C:
 			timer.Reset(utils.NextPollInterval(&pollIntervalBase))